@@ -2,20 +2,46 @@
 package poctools
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
+// Operators accepted as a suffix of a filter query parameter. Ex: created_at[gte]=2024-01-01
+const (
+	OperatorEq      = "eq"
+	OperatorNe      = "ne"
+	OperatorGt      = "gt"
+	OperatorGte     = "gte"
+	OperatorLt      = "lt"
+	OperatorLte     = "lte"
+	OperatorLike    = "like"
+	OperatorBetween = "between"
+	OperatorIn      = "in"
+)
+
 // This structure comes from the UI with pagination data
 type Pagination struct {
 	// Maximum number of lines per query, positive means forward values and negative means backward values
 	Limit int64
-	// A value that will be compared to the database column to get lines bigger that this value
+	// A value that will be compared to the database column to get lines bigger that this value.
+	// It is "last" or an opaque cursor encoded by the DefaultCursorCodec
 	Marker string
+	// Cursor is the decoded Marker, nil for the first and last pages
+	Cursor *CursorState
+	// Page is the 1-based page number read by the PageNumberPagination
+	Page int64
 }
 
 type PaginationResponse[T any] struct {
 	Data       *[]T                     `json:"data"`
 	Pagination PaginationNavigationData `json:"pagination"`
+	// fields are the only fields written in the json data, empty means all of them
+	fields []string
 }
 
 type PaginationNavigationData struct {
@@ -24,6 +50,14 @@ type PaginationNavigationData struct {
 	Next     *string `json:"next"`
 	Last     *string `json:"last"`
 	Total    int64   `json:"total"`
+	// TotalExact is false when the lines were not counted, the total is then an estimate or the count limit
+	TotalExact bool `json:"total_exact"`
+	// HasMore tells if there is a next page, even when the lines were not counted
+	HasMore bool `json:"has_more"`
+	// Page, PerPage and TotalPages are only filled by the PageNumberPagination
+	Page       int64 `json:"page,omitempty"`
+	PerPage    int64 `json:"per_page,omitempty"`
+	TotalPages int64 `json:"total_pages,omitempty"`
 }
 
 // Filter is a generic structure for filtering
@@ -32,8 +66,43 @@ type Filter struct {
 	Name string
 	// Value is the value of the filter
 	Value string
-	// Query is the extra 'where clause' that will be added the the principal query to implement this filter
+	// Query is the extra 'where clause' that will be added the the principal query to implement this filter.
+	// It is a column or an alias.column quoted by the dialect, an expression needs a RawFilter
 	WhereField string
+	// Operators lists the operators accepted besides the equality. Ex: []string{OperatorGte, OperatorLte}
+	Operators []string
+	// Operator is the operator requested for this filter, empty means equality
+	Operator string
+	// Values are the values of an OperatorIn filter, taken from repeated or comma separated parameters.
+	// Repeated parameters are only accepted when OperatorIn is listed in Operators
+	Values []string
+	// MaxValues is the maximum number of values accepted by an OperatorIn filter, zero means DefaultFilterMaxValues
+	MaxValues int
+	// Type is the type the values are parsed to before reaching the database, empty means FilterTypeString
+	Type FilterType
+	// AllowedValues are the values accepted by a FilterTypeEnum filter
+	AllowedValues []string
+	// Aggregate tells that WhereField is an aggregate of a RawFilter, ex: sum(o.amount). Its condition goes to the having clause
+	// of a query with a group by, to the where clause of the others
+	Aggregate bool
+	// args are the parsed values bound to the filter condition
+	args []interface{}
+	// raw tells that WhereField is an expression written as it is, see RawFilter
+	raw bool
+}
+
+// allows tells if the given operator can be used with this filter
+func (f Filter) allows(operator string) bool {
+	return operator == OperatorEq || contains(f.Operators, operator)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 type Order struct {
@@ -41,17 +110,49 @@ type Order struct {
 	Name string
 	// Desc define if it is descendent order or not
 	Desc bool
-	// Field to be added to the order clause
+	// Field to be added to the order clause, a column or an alias.column quoted by the dialect.
+	// An expression needs a RawOrder
 	OrderField string
+	// Column is the result column holding the OrderField value, read by keyset pagination.
+	// Empty means the OrderField without its table alias
+	Column string
+	// Nulls places the null values at the beginning (NullsFirst) or at the end (NullsLast), empty means database default
+	Nulls string
+	// raw tells that OrderField is an expression written as it is, see RawOrder
+	raw bool
 }
 
+const (
+	NullsFirst = "first"
+	NullsLast  = "last"
+)
+
 type ApiParams struct {
+	// BaseURL is the scheme, host and prefix of the navigation links, empty means relative links
+	BaseURL          string
 	RequestedURLPath string
-	Filters          []Filter
-	Order            *Order
-	Pagination       Pagination
-	Options          map[string]bool
-	Logger           interface{}
+	// RequestedQuery are the query parameters of the request, kept in the navigation links
+	RequestedQuery url.Values
+	Filters        []Filter
+	// Conditions are compiled conditions added to the where clause along with the Filters, or to the having clause when aggregate
+	Conditions []Condition
+	// Orders are the sort criteria in order of precedence
+	Orders     []Order
+	Pagination Pagination
+	// Fields are the columns requested by the client, empty means all of them
+	Fields []string
+	// Strategy pages the query, nil means KeysetPagination with the Option.Keyset or the DefaultPaginationStrategy
+	Strategy PaginationStrategy
+	// CountMode chooses how the total of lines is found, empty means the DefaultCountMode
+	CountMode CountMode
+	// CountLimit caps the exact count, 0 means the DefaultCountLimit
+	CountLimit int64
+	// KeyField is the primary key used as tie breaker by keyset pagination, empty means id
+	KeyField string
+	Options  map[string]bool
+	Logger   interface{}
+	// Context of the request, it cancels the queries run in parallel with the Option.Parallel
+	Context context.Context
 }
 
 func NoOrders() []Order {
@@ -62,53 +163,316 @@ func NoFilters() []Filter {
 	return make([]Filter, 0)
 }
 
-func CreateApiParam(ctx *gin.Context, log interface{}, fields []Filter, orders []Order) ApiParams {
+func NoSearch() []string {
+	return make([]string, 0)
+}
+
+func NoFieldSelection() []string {
+	return make([]string, 0)
+}
+
+// CreateApiParam reads the pagination, filters, free text search, order and fields of the request.
+// search are the columns scanned by the "q" parameter and selectable the ones allowed in the "fields" parameter.
+// Invalid parameters are reported with a *ValidationError, that should be answered with a 400
+func CreateApiParam(ctx *gin.Context, log interface{}, fields []Filter, orders []Order, search []string, selectable []string) (ApiParams, error) {
+
+	// the declared fields are a programming error, not an invalid request
+	if _, err := RegisterFilters(fields...); err != nil {
+		return ApiParams{}, err
+	}
+	if _, err := RegisterOrders(orders...); err != nil {
+		return ApiParams{}, err
+	}
+	if _, err := RegisterSearch(search...); err != nil {
+		return ApiParams{}, err
+	}
+
+	verr := &ValidationError{}
 
-	pagination := GeneratePaginationFromRequest(ctx)
-	filters := GenerateFilterFromRequest(ctx, fields)
-	order := GenerateOrderFromRequest(ctx, orders)
+	pagination, err := GeneratePaginationFromRequest(ctx)
+	if err != nil {
+		verr.add("marker", pagination.Marker, err.Error())
+	}
+	filters, err := GenerateFilterFromRequest(ctx, fields)
+	if err = verr.merge(err); err != nil {
+		return ApiParams{}, err
+	}
+	conditions, err := GenerateFilterExpressionFromRequest(ctx, fields)
+	if err = verr.merge(err); err != nil {
+		return ApiParams{}, err
+	}
+	sorting, err := GenerateOrderFromRequest(ctx, orders)
+	if err = verr.merge(err); err != nil {
+		return ApiParams{}, err
+	}
+	selected, err := GenerateFieldsFromRequest(ctx, selectable)
+	if err = verr.merge(err); err != nil {
+		return ApiParams{}, err
+	}
+	if err = verr.orNil(); err != nil {
+		return ApiParams{}, err
+	}
+	conditions = append(conditions, GenerateSearchFromRequest(ctx, search)...)
 
 	requestedURLPath := ctx.Request.URL.Path
 	return ApiParams{
+		BaseURL:          GenerateBaseURLFromRequest(ctx),
 		RequestedURLPath: requestedURLPath,
+		RequestedQuery:   ctx.Request.URL.Query(),
 		Filters:          filters,
+		Conditions:       conditions,
 		Pagination:       pagination,
-		Order:            order,
+		Orders:           sorting,
+		Fields:           selected,
 		Logger:           log,
+		Context:          ctx.Request.Context(),
+	}, nil
+}
+
+// GenerateFieldsFromRequest reads the comma separated or repeated "fields" parameter, only the selectable fields are accepted.
+// Ex: fields=id,name,status
+func GenerateFieldsFromRequest(c *gin.Context, selectable []string) ([]string, error) {
+	fs := []string{}
+	verr := &ValidationError{}
+	used := map[string]bool{}
+
+	for _, value := range c.Request.URL.Query()["fields"] {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if len(field) == 0 || used[field] {
+				continue
+			}
+			if !contains(selectable, field) {
+				verr.add("fields", field, "unknown field")
+				continue
+			}
+			used[field] = true
+			fs = append(fs, field)
+		}
+	}
+
+	if err := verr.orNil(); err != nil {
+		return nil, err
 	}
+	return fs, nil
 }
 
-func GenerateOrderFromRequest(c *gin.Context, orders []Order) *Order {
-	query := c.Request.URL.Query()
+// GenerateOrderFromRequest reads the sort criteria from comma separated or repeated "order" parameters.
+// A "-" prefix sorts descending, "+" ascending and the suffixes ":nulls_first" and ":nulls_last" place the nulls.
+// Ex: order=status,-created_at:nulls_last
+func GenerateOrderFromRequest(c *gin.Context, orders []Order) ([]Order, error) {
+	os := []Order{}
+	verr := &ValidationError{}
+	used := map[string]bool{}
+
+	for _, value := range c.Request.URL.Query()["order"] {
+		for _, item := range strings.Split(value, ",") {
+			name, desc, nulls := parseOrderItem(item)
 
-	for key, value := range query {
-		// Found the order key
-		if key == "order" {
-			queryValue := value[len(value)-1]
-			order := FindOrderByKey(queryValue, orders)
-			if order != nil {
-				return order
+			order := FindOrderByKey(name, orders)
+			if order == nil {
+				verr.add("order", item, "unknown sort field")
+				continue
 			}
+			if used[name] {
+				continue
+			}
+			used[name] = true
+
+			o := *order
+			if desc != nil {
+				o.Desc = *desc
+			}
+			if len(nulls) > 0 {
+				o.Nulls = nulls
+			}
+			os = append(os, o)
 		}
+	}
 
+	if err := verr.orNil(); err != nil {
+		return nil, err
 	}
-	return nil
+	return os, nil
+}
+
+// parseOrderItem splits an item like "-created_at:nulls_last" in its name, direction and nulls placement
+func parseOrderItem(item string) (name string, desc *bool, nulls string) {
+	item = strings.TrimSpace(item)
+
+	if strings.HasSuffix(item, ":nulls_first") {
+		item, nulls = strings.TrimSuffix(item, ":nulls_first"), NullsFirst
+	} else if strings.HasSuffix(item, ":nulls_last") {
+		item, nulls = strings.TrimSuffix(item, ":nulls_last"), NullsLast
+	}
+
+	if strings.HasPrefix(item, "-") || strings.HasPrefix(item, "+") {
+		d := item[0] == '-'
+		return item[1:], &d, nulls
+	}
+	return item, nil, nulls
 }
 
-func GenerateFilterFromRequest(c *gin.Context, fields []Filter) []Filter {
+// GenerateFilterFromRequest parses and validates the filters found in the query parameters.
+// Every invalid parameter is reported in the returned *ValidationError
+func GenerateFilterFromRequest(c *gin.Context, fields []Filter) ([]Filter, error) {
 	fs := []Filter{}
+	verr := &ValidationError{}
 	query := c.Request.URL.Query()
 
-	for key, value := range query {
-		filter := FindFilterByKey(key, fields)
-		if filter != nil {
-			queryValue := value[len(value)-1]
-			filter.Value = queryValue
-			fs = append(fs, *filter)
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := query[key]
+		name, operator := parseFilterKey(key)
+		filter := FindFilterByKey(name, fields)
+		if filter == nil {
+			continue
+		}
+		if !filter.allows(operator) {
+			verr.add(key, value[len(value)-1], "operator not allowed")
+			continue
+		}
+
+		f := *filter
+		f.Operator = operator
+		f.Value = value[len(value)-1]
+
+		if !filter.allows(OperatorIn) && len(value) > 1 {
+			verr.add(key, strings.Join(value, ","), "accepts a single value")
+			continue
+		}
+
+		if filter.allows(OperatorIn) && (operator == OperatorEq || operator == OperatorIn) {
+			values := splitFilterValues(value)
+			if len(values) > f.maxValues() {
+				verr.add(key, strings.Join(value, ","), fmt.Sprintf("accepts at most %d values", f.maxValues()))
+				continue
+			}
+			if operator == OperatorIn && len(values) == 0 {
+				verr.add(key, strings.Join(value, ","), "expects at least one value")
+				continue
+			}
+			if len(values) > 1 || operator == OperatorIn {
+				f.Operator = OperatorIn
+				f.Values = values
+			} else if len(values) == 1 {
+				f.Value = values[0]
+			}
+		}
+
+		if operator == OperatorBetween && len(strings.Split(f.Value, ",")) != 2 {
+			verr.add(key, f.Value, "expects two comma separated values")
+			continue
 		}
+
+		f.coerce(key, verr)
+		fs = append(fs, f)
+	}
+
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (f Filter) maxValues() int {
+	if f.MaxValues > 0 {
+		return f.MaxValues
 	}
+	return DefaultFilterMaxValues
+}
 
-	return fs
+// splitFilterValues joins the values of repeated parameters also splitting comma separated lists.
+// The values are trimmed and the empty ones dropped. Ex: "open, pending," is open and pending
+func splitFilterValues(value []string) []string {
+	values := make([]string, 0, len(value))
+	for _, v := range value {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// GenerateFilterExpressionFromRequest compiles the "filter" query parameter, only the given fields can be used.
+// Ex: filter=status==open,(owner==me;priority=gt=3)
+func GenerateFilterExpressionFromRequest(c *gin.Context, fields []Filter) ([]Condition, error) {
+	conditions := []Condition{}
+	verr := &ValidationError{}
+
+	for _, expression := range c.Request.URL.Query()["filter"] {
+		node, err := ParseFilterExpression(expression)
+		if err != nil {
+			verr.add("filter", expression, err.Error())
+			continue
+		}
+
+		condition, err := CompileFilterExpression(node, fields)
+		if err = verr.merge(err); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+	return conditions, nil
+}
+
+// GenerateSearchFromRequest turns every "q" parameter in a case insensitive search over the given columns,
+// quoted by the dialect. The columns are checked by RegisterSearch, the invalid ones are skipped.
+// Ex: q=john with columns u.name and u.email is (lower(u.name) like '%john%' or lower(u.email) like '%john%')
+func GenerateSearchFromRequest(c *gin.Context, columns []string) []Condition {
+	conditions := []Condition{}
+	columns = searchColumns(columns)
+	if len(columns) == 0 {
+		return conditions
+	}
+
+	for _, term := range c.Request.URL.Query()["q"] {
+		term = strings.TrimSpace(term)
+		if len(term) == 0 {
+			continue
+		}
+
+		pattern := "%" + escapeLike(strings.ToLower(term)) + "%"
+		likes := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, column := range columns {
+			likes[i] = fmt.Sprintf("lower(%s) like ? escape '!'", sqlField(column, false))
+			args[i] = pattern
+		}
+		conditions = append(conditions, Condition{Sql: strings.Join(likes, " or "), Args: args})
+	}
+	return conditions
+}
+
+// searchColumns keeps the search columns that are a column or an alias.column
+func searchColumns(columns []string) []string {
+	valid := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if isIdentifier(column) {
+			valid = append(valid, column)
+		}
+	}
+	return valid
+}
+
+// parseFilterKey splits a query parameter like "created_at[gte]" in its name and operator
+func parseFilterKey(key string) (name, operator string) {
+	open := strings.Index(key, "[")
+	if open <= 0 || !strings.HasSuffix(key, "]") {
+		return key, OperatorEq
+	}
+	return key[:open], key[open+1 : len(key)-1]
 }
 
 func FindFilterByKey(key string, list []Filter) *Filter {
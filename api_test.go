@@ -0,0 +1,65 @@
+package poctools
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func requestContext(target string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c
+}
+
+func TestGenerateFilterFromRequestValues(t *testing.T) {
+	fields := []Filter{
+		{Name: "status", WhereField: "status", Operators: []string{OperatorIn}},
+		{Name: "id", WhereField: "id", Type: FilterTypeInt, Operators: []string{OperatorIn}},
+		{Name: "name", WhereField: "name"},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		operator string
+		args     []interface{}
+		reason   string
+	}{
+		{"comma separated values", "status=open,pending", OperatorIn, []interface{}{"open", "pending"}, ""},
+		{"blanks around the values", "status=open,%20pending%20", OperatorIn, []interface{}{"open", "pending"}, ""},
+		{"typed values with blanks", "id=1,%202", OperatorIn, []interface{}{int64(1), int64(2)}, ""},
+		{"repeated parameters", "status=open&status=%20pending", OperatorIn, []interface{}{"open", "pending"}, ""},
+		{"empty values dropped", "status=open,,%20,", OperatorEq, []interface{}{"open"}, ""},
+		{"single trimmed value", "id=%207%20", OperatorEq, []interface{}{int64(7)}, ""},
+		{"in without values", "status[in]=,%20", "", nil, "expects at least one value"},
+		{"filter without lists", "name=Smith,%20John", OperatorEq, []interface{}{"Smith, John"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := GenerateFilterFromRequest(requestContext("/lines?"+tt.query), fields)
+			if len(tt.reason) > 0 {
+				verr, ok := err.(*ValidationError)
+				if !ok || len(verr.Errors) != 1 || verr.Errors[0].Reason != tt.reason {
+					t.Fatalf("got %v, want the reason %q", err, tt.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(filters) != 1 {
+				t.Fatalf("got %d filters, want 1", len(filters))
+			}
+			if filters[0].Operator != tt.operator {
+				t.Errorf("got the operator %q, want %q", filters[0].Operator, tt.operator)
+			}
+			if got := filters[0].boundValues(); !reflect.DeepEqual(got, tt.args) {
+				t.Errorf("got %#v, want %#v", got, tt.args)
+			}
+		})
+	}
+}
@@ -1,3 +1,39 @@
 package poctools
 
+import "time"
+
 var DefaultPaginationLimit int64
+
+var DefaultFilterMaxValues = 100
+
+// DefaultCursorCodec encodes the pagination markers, set a signed or encrypted codec to protect them
+var DefaultCursorCodec CursorCodec = Base64CursorCodec{}
+
+// DefaultPaginationOutput chooses where RespondPaginated writes the pagination data
+var DefaultPaginationOutput = PaginationOutputEnvelope
+
+// PublicBaseURL is the scheme, host and prefix of the navigation links. Ex: https://api.example.com/public
+// Empty means the links are built from the forwarded headers of trusted proxies, or are relative
+var PublicBaseURL string
+
+// DefaultPaginationStrategy is used by the params without their own strategy
+var DefaultPaginationStrategy PaginationStrategy = OffsetPagination{}
+
+// DefaultCountMode is used by the params without their own count mode
+var DefaultCountMode = CountExact
+
+// DefaultCountLimit caps the exact count of lines, the total is then reported as not exact. 0 counts all the lines
+var DefaultCountLimit int64
+
+// DefaultCountEstimator gives the totals of the CountEstimated mode
+var DefaultCountEstimator CountEstimator = ExplainCountEstimator{}
+
+// DefaultCountCache keeps the exact totals shared by the executors
+var DefaultCountCache = NewLruCountCache(1000)
+
+// DefaultCountCacheTTL is how long the totals are kept in the count cache, 0 disables the cache
+var DefaultCountCacheTTL time.Duration
+
+// SupportsWindowFunctions turns off the count(*) over() of the dialect when false, ex: for MySQL before 8.0.
+// Without window functions the CountWindow mode counts with a second query
+var SupportsWindowFunctions = true
@@ -0,0 +1,265 @@
+package poctools
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// CountMode chooses how the total of lines of a paginated query is found
+type CountMode string
+
+const (
+	// CountExact counts the lines, up to the count limit when there is one
+	CountExact CountMode = "exact"
+	// CountNone does not count, only telling if there is a next page
+	CountNone CountMode = "none"
+	// CountEstimated reads the estimate of the DefaultCountEstimator.
+	// When there is no estimate, ex: SQLite or SQL Server without a json query plan, the lines are not counted like CountNone
+	CountEstimated CountMode = "estimated"
+	// CountWindow reads the total with the page in a count(*) over() column, without a second query.
+	// The lines must be structs. An empty page, a distinct query or a dialect without window functions uses an exact count
+	CountWindow CountMode = "window"
+)
+
+// windowTotalColumn holds the total of lines in the lines of the CountWindow mode
+const windowTotalColumn = "__total"
+
+// CountEstimator returns an estimate of the lines of a query, from the query plan of the database.
+// An error means there is no estimate, the page is then read without a total
+type CountEstimator interface {
+	EstimateCount(ds DbSession, query string, pars ...interface{}) (int64, error)
+}
+
+// countMode returns the count mode of the params: none with the Option.NoCount, their own or the DefaultCountMode
+func countMode(p ApiParams) CountMode {
+	mode := DefaultCountMode
+	if p.Options[Option.NoCount] {
+		mode = CountNone
+	} else if len(p.CountMode) > 0 {
+		mode = p.CountMode
+	}
+
+	if mode == CountWindow && (!SupportsWindowFunctions || !GetDialect().SupportsWindowFunctions()) {
+		return CountExact
+	}
+	return mode
+}
+
+// countLimit returns the maximum number of lines counted, 0 counts them all
+func countLimit(p ApiParams) int64 {
+	if p.CountLimit > 0 {
+		return p.CountLimit
+	}
+	return DefaultCountLimit
+}
+
+// readCount finds the total of lines of the filtered query according to the count mode.
+// The exact totals are kept in the count cache of the executor when the DefaultCountCacheTTL is set
+func (S *sqlExecutor) readCount(q pagedQuery, p ApiParams) (PageCount, error) {
+	count := PageCount{}
+
+	switch countMode(p) {
+	case CountNone:
+		return count, nil
+
+	case CountEstimated:
+		// without an estimate the next page is still known from the line read after the page
+		query, pars := q.Build()
+		if total, err := DefaultCountEstimator.EstimateCount(S.ds, query, pars...); err == nil {
+			count.Total = total
+		}
+		return count, nil
+
+	case CountWindow:
+		// the page did not carry the total, the window count is never limited
+		return S.exactCount(q, 0)
+	}
+
+	return S.exactCount(q, countLimit(p))
+}
+
+// exactCount counts the lines of the query, up to the limit when it is not 0
+func (S *sqlExecutor) exactCount(q pagedQuery, limit int64) (PageCount, error) {
+	count := PageCount{}
+
+	countQuery, pars := q.countQuery(limit)
+
+	total, err := S.cachedCount(countQuery, pars...)
+	if err != nil {
+		return count, err
+	}
+
+	count.Total = total
+	count.Exact = true
+	if limit > 0 && count.Total > limit {
+		count.Total = limit
+		count.Exact = false
+	}
+	return count, nil
+}
+
+// cachedCount runs the count query, unless its total is in the count cache
+func (S *sqlExecutor) cachedCount(countQuery string, pars ...interface{}) (int64, error) {
+	useCache := S.cache != nil && DefaultCountCacheTTL > 0
+
+	key := countCacheKey(countQuery, pars)
+	if useCache {
+		if total, ok := S.cache.Get(key); ok {
+			return total, nil
+		}
+	}
+
+	var res []int64
+	err := S.ds.ReadMany(countQuery, &res, pars...)
+	if err != nil || len(res) == 0 {
+		message := "error reading total from paginated query execution"
+		return 0, fmt.Errorf(message)
+	}
+
+	if useCache {
+		S.cache.Set(key, readTables(countQuery), res[0], DefaultCountCacheTTL)
+	}
+	return res[0], nil
+}
+
+// getCountQuery counts the lines of the query, only the first limit + 1 lines when a limit is given.
+// The queries whose lines are not the lines of their tables are counted as a sub query
+func getCountQuery(query string, limit int64) (string, []interface{}) {
+	// the common table expressions stay in front of the count, they can not be in a derived table everywhere.
+	// The lines are not locked to be counted, PostgreSQL rejects a locking clause with an aggregate
+	with, query := splitWith(trimQuery(query))
+	query = removeClause(query, clauseFor)
+
+	a := analyzeQuery(query)
+	limited := a.has(clauseLimit) || a.has(clauseOffset) || a.has(clauseFetch)
+	wrapped := a.union || a.distinct || a.has(clauseGroupBy) || a.has(clauseHaving) || limited
+
+	// the sort only matters to the lines kept by a limit, SQL Server rejects it in a derived table without one
+	if !limited {
+		query = removeClause(query, clauseOrderBy)
+	}
+
+	if limit > 0 {
+		if wrapped {
+			query = fmt.Sprintf("select 1 from (%s) as counted", query)
+		} else {
+			query = replaceSelectList(query, "1")
+		}
+		clause, pars := GetDialect().LimitOffset(limit+1, 0, false)
+		return joinWith(with, fmt.Sprintf("select count(1) from (%s) as cnt", splice(query, len(query), len(query), clause))), pars
+	}
+
+	if wrapped {
+		return joinWith(with, fmt.Sprintf("select count(1) from (%s) as cnt", query)), nil
+	}
+	return joinWith(with, replaceSelectList(query, "count(1)")), nil
+}
+
+// windowed tells if the page is read with its total in a count(*) over() column.
+// The keyset pages are not, their seek condition would be counted, nor the distinct queries
+// whose window is computed before their duplicates are removed
+func windowed(p ApiParams, entity interface{}, q pagedQuery) bool {
+	if countMode(p) != CountWindow || q.isDistinct() {
+		return false
+	}
+	if _, keyset := paginationStrategy(p).(KeysetPagination); keyset {
+		return false
+	}
+
+	t := reflect.TypeOf(entity)
+	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice && t.Elem().Elem().Kind() == reflect.Struct
+}
+
+// windowCountColumn is the count(*) over() column added at the end of the select list of the page
+func windowCountColumn() string {
+	return fmt.Sprintf("count(*) over() as %s", windowTotalColumn)
+}
+
+// readWindowPage reads the lines with the total column, returning the total or nil for an empty page
+func readWindowPage(ds DbSession, query string, entity interface{}, pars ...interface{}) (*int64, error) {
+	rows := reflect.ValueOf(entity).Elem()
+	lineType := reflect.StructOf([]reflect.StructField{
+		{Name: "Line", Type: rows.Type().Elem(), Anonymous: true},
+		{Name: "WindowTotal", Type: reflect.TypeOf(int64(0)), Tag: reflect.StructTag(fmt.Sprintf(`db:"%s"`, windowTotalColumn))},
+	})
+
+	lines := reflect.New(reflect.SliceOf(lineType))
+	if err := ds.ReadMany(query, lines.Interface(), pars...); err != nil {
+		return nil, err
+	}
+
+	lines = lines.Elem()
+	if lines.Len() == 0 {
+		return nil, nil
+	}
+
+	for i := 0; i < lines.Len(); i++ {
+		rows.Set(reflect.Append(rows, lines.Index(i).Field(0)))
+	}
+	total := lines.Index(0).Field(1).Int()
+	return &total, nil
+}
+
+// ExplainCountEstimator reads the estimate of the planner with the json explain of the dialect, MySQL or PostgreSQL
+type ExplainCountEstimator struct{}
+
+func (ExplainCountEstimator) EstimateCount(ds DbSession, query string, pars ...interface{}) (int64, error) {
+	explain := GetDialect().Explain(query)
+	if len(explain) == 0 {
+		return 0, fmt.Errorf("the %s dialect has no json query plan", GetDialect().Name())
+	}
+
+	var plans []string
+	if err := ds.ReadMany(explain, &plans, pars...); err != nil {
+		return 0, err
+	}
+	if len(plans) == 0 {
+		return 0, fmt.Errorf("empty query plan")
+	}
+
+	var plan interface{}
+	if err := json.Unmarshal([]byte(plans[0]), &plan); err != nil {
+		return 0, err
+	}
+
+	rows, ok := planRows(plan)
+	if !ok {
+		return 0, fmt.Errorf("no row estimate in the query plan")
+	}
+	return rows, nil
+}
+
+// planRows finds the lines produced by a query plan: the ones of the top node for PostgreSQL, of the last table of a join for MySQL
+func planRows(node interface{}) (int64, bool) {
+	switch n := node.(type) {
+	case []interface{}:
+		if len(n) > 0 {
+			return planRows(n[len(n)-1])
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"Plan Rows", "rows_produced_per_join"} {
+			if rows, ok := n[key]; ok {
+				return planNumber(rows)
+			}
+		}
+		for _, key := range []string{"Plan", "query_block", "nested_loop", "grouping_operation", "ordering_operation", "duplicates_removal", "table"} {
+			if child, ok := n[key]; ok {
+				return planRows(child)
+			}
+		}
+	}
+	return 0, false
+}
+
+func planNumber(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int64(n), true
+	case string:
+		rows, err := strconv.ParseFloat(n, 64)
+		return int64(rows), err == nil
+	}
+	return 0, false
+}
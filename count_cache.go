@@ -0,0 +1,148 @@
+package poctools
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CountCache keeps the totals of the count queries, so the pages of a same list do not count the lines again
+type CountCache interface {
+	Get(key string) (int64, bool)
+	// Set keeps the total for the ttl, or until one of the tables is invalidated
+	Set(key string, tables []string, total int64, ttl time.Duration)
+	// Invalidate removes the totals read from the table
+	Invalidate(table string)
+}
+
+// countCacheKey normalizes the blanks and comments of the count query and appends its arguments
+func countCacheKey(query string, pars []interface{}) string {
+	key := normalizeSQL(query)
+	for _, p := range pars {
+		key = fmt.Sprintf("%s|%#v", key, p)
+	}
+	return key
+}
+
+// readTables returns the tables read by a query, the ones after a from or a join at any depth
+func readTables(query string) []string {
+	var tables []string
+	tokens := lexSQL(query)
+	for i, t := range tokens {
+		if t.is("from") || t.is("join") {
+			if name, _ := identifierAt(tokens, nextSignificant(tokens, i)); len(name) > 0 {
+				tables = append(tables, tableName(name))
+			}
+		}
+	}
+	return tables
+}
+
+// writtenTable returns the table changed by an insert, replace, update or delete, empty when unknown
+func writtenTable(query string) string {
+	tokens := lexSQL(query)
+
+	i := nextSignificant(tokens, -1)
+	if i < 0 {
+		return ""
+	}
+
+	// the words allowed between the statement and the table
+	skipped := map[string]bool{"into": true, "from": true, "ignore": true, "low_priority": true, "delayed": true, "only": true}
+	switch strings.ToLower(tokens[i].text) {
+	case "insert", "replace", "update", "delete":
+		for i = nextSignificant(tokens, i); i >= 0 && tokens[i].kind == tokenWord && skipped[strings.ToLower(tokens[i].text)]; {
+			i = nextSignificant(tokens, i)
+		}
+		name, _ := identifierAt(tokens, i)
+		return tableName(name)
+	}
+	return ""
+}
+
+// tableName removes the quotes of each part of the name
+func tableName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = strings.ToLower(strings.Trim(p, "`\"[]"))
+	}
+	return strings.Join(parts, ".")
+}
+
+// NewLruCountCache keeps at most size totals in memory, the least recently used are removed first
+func NewLruCountCache(size int) CountCache {
+	return &lruCountCache{size: size, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+type lruCountCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type countCacheEntry struct {
+	key     string
+	tables  []string
+	total   int64
+	expires time.Time
+}
+
+func (c *lruCountCache) Get(key string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+
+	entry := e.Value.(*countCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		return 0, false
+	}
+
+	c.order.MoveToFront(e)
+	return entry.total, true
+}
+
+func (c *lruCountCache) Set(key string, tables []string, total int64, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+
+	entry := &countCacheEntry{key: key, tables: tables, total: total, expires: time.Now().Add(ttl)}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *lruCountCache) Invalidate(table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	table = tableName(table)
+	for e := c.order.Front(); e != nil; {
+		next := e.Next()
+		for _, t := range e.Value.(*countCacheEntry).tables {
+			if t == table {
+				c.remove(e)
+				break
+			}
+		}
+		e = next
+	}
+}
+
+func (c *lruCountCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*countCacheEntry).key)
+}
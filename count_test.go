@@ -0,0 +1,43 @@
+package poctools
+
+import (
+	"testing"
+)
+
+func TestEstimatedCountWithoutQueryPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+	}{
+		{"sqlite", SQLite},
+		{"sqlserver", SQLServer},
+	}
+
+	defer SetDialect(MySQL)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			params := ApiParams{
+				RequestedURLPath: "/lines",
+				Strategy:         OffsetPagination{},
+				CountMode:        CountEstimated,
+				Pagination:       Pagination{Limit: 10},
+			}
+			s := CreateSqlExecutorWithCountCache(&pagedSession{lines: pagedLines(1, 11), total: 20}, nil)
+
+			r, err := PaginatorFor(pagedLine{}).WithSqlExecutor(s).WithQuery("select id, name from lines").WithParams(params).Do()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if r.Pagination.TotalExact || r.Pagination.Total != 0 {
+				t.Errorf("got total %d exact %v, want an unknown total", r.Pagination.Total, r.Pagination.TotalExact)
+			}
+			if !r.Pagination.HasMore || r.Pagination.Next == nil {
+				t.Errorf("got has more %v and next %v, want a next page", r.Pagination.HasMore, r.Pagination.Next)
+			}
+			if len(*r.Data) != 10 {
+				t.Errorf("got %d lines, want 10", len(*r.Data))
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package poctools
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrInvalidCursor is matched by every error caused by a forged, corrupted or unreadable marker
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// CursorError tells why a marker was rejected
+type CursorError struct {
+	Reason string
+}
+
+func (e *CursorError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidCursor.Error(), e.Reason)
+}
+
+func (e *CursorError) Is(target error) bool {
+	return target == ErrInvalidCursor
+}
+
+// CursorState is the position carried by the pagination markers
+type CursorState struct {
+	// Offset of the first line, used by the offset pagination
+	Offset int64 `json:"o,omitempty"`
+	// Values of the sort fields of the reference line, the primary key included. Used by the keyset pagination
+	Values []interface{} `json:"v,omitempty"`
+	// Backward asks for the lines before the reference line
+	Backward bool `json:"b,omitempty"`
+}
+
+// CursorCodec turns a cursor state in an opaque marker and back, the DefaultCursorCodec is used by the pagination
+type CursorCodec interface {
+	Encode(c CursorState) (string, error)
+	// Decode must return a *CursorError for markers it can not trust
+	Decode(marker string) (CursorState, error)
+}
+
+// Base64CursorCodec only encodes the cursor state as base64url json, the markers can be read and edited.
+// Plain integer markers are still accepted as offsets
+type Base64CursorCodec struct{}
+
+func (Base64CursorCodec) Encode(c CursorState) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (Base64CursorCodec) Decode(marker string) (CursorState, error) {
+	if offset, err := strconv.ParseInt(marker, 10, 64); err == nil {
+		if offset < 0 {
+			return CursorState{}, &CursorError{Reason: "negative offset"}
+		}
+		return CursorState{Offset: offset}, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(marker)
+	if err != nil {
+		return CursorState{}, &CursorError{Reason: "bad encoding"}
+	}
+	return unmarshalCursor(data)
+}
+
+// NewHmacCursorCodec signs the markers with HMAC-SHA256, they can still be read but not forged.
+// The first key signs, all of them are accepted to verify so the keys can be rotated
+func NewHmacCursorCodec(keys ...[]byte) (CursorCodec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+	return &hmacCursorCodec{keys: keys}, nil
+}
+
+type hmacCursorCodec struct {
+	keys [][]byte
+}
+
+func (h *hmacCursorCodec) Encode(c CursorState) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	data = append(data, sign(h.keys[0], data)...)
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (h *hmacCursorCodec) Decode(marker string) (CursorState, error) {
+	data, err := base64.RawURLEncoding.DecodeString(marker)
+	if err != nil || len(data) <= sha256.Size {
+		return CursorState{}, &CursorError{Reason: "bad encoding"}
+	}
+
+	payload, signature := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	for _, key := range h.keys {
+		if hmac.Equal(signature, sign(key, payload)) {
+			return unmarshalCursor(payload)
+		}
+	}
+	return CursorState{}, &CursorError{Reason: "bad signature"}
+}
+
+func sign(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// NewAesGcmCursorCodec encrypts the markers with AES-GCM, they can not be read nor forged.
+// The keys must have 16, 24 or 32 bytes. The first key encrypts, all of them are tried to decrypt
+func NewAesGcmCursorCodec(keys ...[]byte) (CursorCodec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+
+	aeads := make([]cipher.AEAD, len(keys))
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d: %w", i, err)
+		}
+		aeads[i], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d: %w", i, err)
+		}
+	}
+	return &aesGcmCursorCodec{aeads: aeads}, nil
+}
+
+type aesGcmCursorCodec struct {
+	aeads []cipher.AEAD
+}
+
+func (a *aesGcmCursorCodec) Encode(c CursorState) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	aead := a.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+func (a *aesGcmCursorCodec) Decode(marker string) (CursorState, error) {
+	data, err := base64.RawURLEncoding.DecodeString(marker)
+	if err != nil {
+		return CursorState{}, &CursorError{Reason: "bad encoding"}
+	}
+
+	for _, aead := range a.aeads {
+		if len(data) <= aead.NonceSize() {
+			continue
+		}
+		payload, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+		if err == nil {
+			return unmarshalCursor(payload)
+		}
+	}
+	return CursorState{}, &CursorError{Reason: "unable to decrypt"}
+}
+
+func unmarshalCursor(data []byte) (CursorState, error) {
+	var c CursorState
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return c, &CursorError{Reason: "bad content"}
+	}
+	if c.Offset < 0 {
+		return c, &CursorError{Reason: "negative offset"}
+	}
+
+	for i, v := range c.Values {
+		if n, ok := v.(json.Number); ok {
+			c.Values[i] = numberValue(n)
+		}
+	}
+	return c, nil
+}
+
+func numberValue(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+// cursor returns the decoded marker, the zero state for the first and last pages
+func (p Pagination) cursor() (CursorState, error) {
+	if p.Cursor != nil {
+		return *p.Cursor, nil
+	}
+	if len(p.Marker) == 0 || p.Marker == "last" {
+		return CursorState{}, nil
+	}
+	return DefaultCursorCodec.Decode(p.Marker)
+}
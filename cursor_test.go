@@ -0,0 +1,181 @@
+package poctools
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var (
+	oldCursorKey = []byte("0123456789abcdef0123456789abcdef")
+	newCursorKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func mustCursorCodec(t *testing.T, newCodec func(keys ...[]byte) (CursorCodec, error), keys ...[]byte) CursorCodec {
+	t.Helper()
+	codec, err := newCodec(keys...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return codec
+}
+
+// tamper flips a bit of the decoded marker at the given position, a negative one counts from the end
+func tamper(t *testing.T, marker string, at int) string {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(marker)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if at < 0 {
+		at += len(data)
+	}
+	data[at] ^= 1
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestCursorCodecRoundTrip(t *testing.T) {
+	codecs := map[string]CursorCodec{
+		"base64":  Base64CursorCodec{},
+		"hmac":    mustCursorCodec(t, NewHmacCursorCodec, oldCursorKey),
+		"aes-gcm": mustCursorCodec(t, NewAesGcmCursorCodec, oldCursorKey),
+	}
+	states := []CursorState{
+		{},
+		{Offset: 40},
+		{Values: []interface{}{"bob", int64(12)}, Backward: true},
+		{Values: []interface{}{1.5, nil, true}},
+	}
+
+	for name, codec := range codecs {
+		for _, state := range states {
+			marker, err := codec.Encode(state)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+			got, err := codec.Decode(marker)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+			if !reflect.DeepEqual(got, state) {
+				t.Errorf("%s: got %#v, want %#v", name, got, state)
+			}
+		}
+	}
+}
+
+func TestCursorCodecTampering(t *testing.T) {
+	hmacCodec := mustCursorCodec(t, NewHmacCursorCodec, oldCursorKey)
+	aesCodec := mustCursorCodec(t, NewAesGcmCursorCodec, oldCursorKey)
+	state := CursorState{Offset: 20, Values: []interface{}{"bob", int64(12)}}
+
+	hmacMarker, err := hmacCodec.Encode(state)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	aesMarker, err := aesCodec.Encode(state)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	forged, err := Base64CursorCodec{}.Encode(CursorState{Offset: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		codec  CursorCodec
+		marker string
+		reason string
+	}{
+		{"hmac payload changed", hmacCodec, tamper(t, hmacMarker, 2), "bad signature"},
+		{"hmac signature changed", hmacCodec, tamper(t, hmacMarker, -1), "bad signature"},
+		{"hmac signature removed", hmacCodec, forged, "bad encoding"},
+		{"hmac not base64", hmacCodec, "not a marker!", "bad encoding"},
+		{"hmac plain offset", hmacCodec, "1000", "bad encoding"},
+		{"aes nonce changed", aesCodec, tamper(t, aesMarker, 0), "unable to decrypt"},
+		{"aes cipher text changed", aesCodec, tamper(t, aesMarker, 14), "unable to decrypt"},
+		{"aes tag changed", aesCodec, tamper(t, aesMarker, -1), "unable to decrypt"},
+		{"aes truncated", aesCodec, aesMarker[:10], "unable to decrypt"},
+		{"aes unencrypted", aesCodec, forged, "unable to decrypt"},
+		{"aes not base64", aesCodec, "not a marker!", "bad encoding"},
+		{"base64 negative offset", Base64CursorCodec{}, "-20", "negative offset"},
+		{"base64 bad content", Base64CursorCodec{}, base64.RawURLEncoding.EncodeToString([]byte("{")), "bad content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.codec.Decode(tt.marker)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("got %v, want an ErrInvalidCursor", err)
+			}
+			var cerr *CursorError
+			if !errors.As(err, &cerr) || cerr.Reason != tt.reason {
+				t.Errorf("got %v, want the reason %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCursorCodecKeyRotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   func(keys ...[]byte) (CursorCodec, error)
+		invalid string
+	}{
+		{"hmac", NewHmacCursorCodec, "bad signature"},
+		{"aes-gcm", NewAesGcmCursorCodec, "unable to decrypt"},
+	}
+
+	state := CursorState{Values: []interface{}{"bob", int64(12)}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := mustCursorCodec(t, tt.codec, oldCursorKey)
+			rotated := mustCursorCodec(t, tt.codec, newCursorKey, oldCursorKey)
+			after := mustCursorCodec(t, tt.codec, newCursorKey)
+
+			oldMarker, err := before.Encode(state)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, err := rotated.Decode(oldMarker); err != nil || !reflect.DeepEqual(got, state) {
+				t.Errorf("a marker of the old key: got %#v %v, want %#v", got, err, state)
+			}
+
+			newMarker, err := rotated.Encode(state)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, err := after.Decode(newMarker); err != nil || !reflect.DeepEqual(got, state) {
+				t.Errorf("a marker of the rotated codec: got %#v %v, want %#v", got, err, state)
+			}
+
+			var cerr *CursorError
+			if _, err := after.Decode(oldMarker); !errors.As(err, &cerr) || cerr.Reason != tt.invalid {
+				t.Errorf("a marker of the removed key: got %v, want the reason %q", err, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestCursorCodecKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec func(keys ...[]byte) (CursorCodec, error)
+		keys  [][]byte
+	}{
+		{"hmac without key", NewHmacCursorCodec, nil},
+		{"aes-gcm without key", NewAesGcmCursorCodec, nil},
+		{"aes-gcm short key", NewAesGcmCursorCodec, [][]byte{[]byte("short")}},
+		{"aes-gcm one invalid key", NewAesGcmCursorCodec, [][]byte{newCursorKey, []byte("short")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.codec(tt.keys...); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -10,8 +10,12 @@ func GetDbEngine() *sqlx.DB {
 	return databaseEngine
 }
 
+// SetDbEngine sets the database engine and the dialect of its driver
 func SetDbEngine(e *sqlx.DB) {
 	databaseEngine = e
+	if e != nil {
+		SetDialect(DialectFor(e.DriverName()))
+	}
 }
 
 func GetTransactionObject() (*sqlx.Tx, error) {
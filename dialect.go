@@ -0,0 +1,380 @@
+package poctools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect writes the parts of the SQL that differ between the databases.
+// The package writes its queries with ? placeholders, they are rebound by the dialect before running.
+// The dialect also tells the lexer how the quotes and comments of the database are written
+type Dialect interface {
+	Name() string
+	// Rebind turns the ? placeholders in the placeholders of the database.
+	// The numbered ones start after the highest native placeholder of the query, ex: $2 after a $1,
+	// as the arguments added by the package follow the arguments of the query
+	Rebind(query string) string
+	// LimitOffset returns the clause reading limit lines after offset ones, with its arguments.
+	// ordered tells if the query already has an order by clause
+	LimitOffset(limit, offset int64, ordered bool) (string, []interface{})
+	// OrderItem returns a sort criterion, nulls is empty, NullsFirst or NullsLast
+	OrderItem(field string, desc bool, nulls string) string
+	// QuoteIdentifier quotes a name, each part of a dotted name is quoted
+	QuoteIdentifier(name string) string
+	// Upsert returns the named insert of the columns, updating the line with the same keys when it exists
+	Upsert(table string, columns, keys []string) string
+	// Returning adds to an insert the clause giving back the columns, the insert is unchanged when the database can not
+	Returning(insert string, columns ...string) string
+	// UsesLastInsertId tells if the id of an insert is read from the driver instead of a returning clause
+	UsesLastInsertId() bool
+	// Explain returns the query giving the json plan of the query, empty when the database can not
+	Explain(query string) string
+	// SupportsWindowFunctions tells if count(*) over() is available, SupportsWindowFunctions turns it off for older servers
+	SupportsWindowFunctions() bool
+	// SupportsRowValues tells if the row comparisons (a, b) > (?, ?) are available
+	SupportsRowValues() bool
+	// NullsLargest tells if the nulls are sorted after the other values without nulls first or nulls last
+	NullsLargest() bool
+}
+
+var (
+	MySQL      Dialect = mysqlDialect{}
+	PostgreSQL Dialect = postgresDialect{}
+	SQLite     Dialect = sqliteDialect{}
+	SQLServer  Dialect = sqlServerDialect{}
+)
+
+var dialect = MySQL
+
+// GetDialect returns the dialect of the database engine, MySQL when no engine is set
+func GetDialect() Dialect {
+	return dialect
+}
+
+// SetDialect replaces the dialect chosen from the driver of the database engine
+func SetDialect(d Dialect) {
+	dialect = d
+}
+
+// DialectFor returns the dialect of a sqlx driver name, MySQL for the unknown drivers
+func DialectFor(driverName string) Dialect {
+	switch driverName {
+	case "postgres", "pgx", "pgx/v4", "pgx/v5", "pq-timeouts", "cloudsqlpostgres", "nrpostgres", "cockroach":
+		return PostgreSQL
+	case "sqlite3", "sqlite", "nrsqlite3":
+		return SQLite
+	case "sqlserver", "mssql", "azuresql":
+		return SQLServer
+	}
+	return MySQL
+}
+
+// ansiDialect is the syntax shared by most of the databases
+type ansiDialect struct{}
+
+func (ansiDialect) Rebind(query string) string {
+	return query
+}
+
+func (ansiDialect) LimitOffset(limit, offset int64, ordered bool) (string, []interface{}) {
+	if offset > 0 {
+		return "limit ? offset ?", []interface{}{limit, offset}
+	}
+	return "limit ?", []interface{}{limit}
+}
+
+func (ansiDialect) OrderItem(field string, desc bool, nulls string) string {
+	item := field
+	if desc {
+		item = fmt.Sprintf("%s desc", item)
+	}
+	if len(nulls) > 0 {
+		item = fmt.Sprintf("%s nulls %s", item, nulls)
+	}
+	return item
+}
+
+func (ansiDialect) Returning(insert string, columns ...string) string {
+	if len(columns) == 0 {
+		return insert
+	}
+	return fmt.Sprintf("%s returning %s", insert, strings.Join(columns, ", "))
+}
+
+func (ansiDialect) UsesLastInsertId() bool {
+	return false
+}
+
+func (ansiDialect) SupportsWindowFunctions() bool {
+	return true
+}
+
+func (ansiDialect) SupportsRowValues() bool {
+	return true
+}
+
+func (ansiDialect) NullsLargest() bool {
+	return false
+}
+
+type mysqlDialect struct {
+	ansiDialect
+}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+// OrderItem places the nulls with an is null criterion, MySQL has no nulls first or nulls last
+func (mysqlDialect) OrderItem(field string, desc bool, nulls string) string {
+	return nullsOrderItem(field, desc, nulls)
+}
+
+func (mysqlDialect) QuoteIdentifier(name string) string {
+	return quoteParts(name, "`", "`")
+}
+
+func (d mysqlDialect) Upsert(table string, columns, keys []string) string {
+	updates := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if !contains(keys, c) {
+			updates = append(updates, fmt.Sprintf("%s = values(%s)", d.QuoteIdentifier(c), d.QuoteIdentifier(c)))
+		}
+	}
+	return fmt.Sprintf("%s on duplicate key update %s", namedInsert(d, table, columns), strings.Join(updates, ", "))
+}
+
+func (mysqlDialect) Returning(insert string, columns ...string) string {
+	return insert
+}
+
+func (mysqlDialect) UsesLastInsertId() bool {
+	return true
+}
+
+func (mysqlDialect) Explain(query string) string {
+	return fmt.Sprintf("explain format=json %s", query)
+}
+
+type postgresDialect struct {
+	ansiDialect
+}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Rebind(query string) string {
+	return rebindPlaceholders(query, "$%d")
+}
+
+func (postgresDialect) QuoteIdentifier(name string) string {
+	return quoteParts(name, `"`, `"`)
+}
+
+func (d postgresDialect) Upsert(table string, columns, keys []string) string {
+	return conflictUpsert(d, table, columns, keys)
+}
+
+func (postgresDialect) NullsLargest() bool {
+	return true
+}
+
+func (postgresDialect) Explain(query string) string {
+	return fmt.Sprintf("explain (format json) %s", query)
+}
+
+type sqliteDialect struct {
+	ansiDialect
+}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string {
+	return quoteParts(name, `"`, `"`)
+}
+
+func (d sqliteDialect) Upsert(table string, columns, keys []string) string {
+	return conflictUpsert(d, table, columns, keys)
+}
+
+func (sqliteDialect) UsesLastInsertId() bool {
+	return true
+}
+
+func (sqliteDialect) Explain(query string) string {
+	return ""
+}
+
+type sqlServerDialect struct {
+	ansiDialect
+}
+
+func (sqlServerDialect) Name() string {
+	return "sqlserver"
+}
+
+func (sqlServerDialect) Rebind(query string) string {
+	return rebindPlaceholders(query, "@p%d")
+}
+
+// LimitOffset uses offset fetch, it needs an order by so the lines are kept in their order when there is none
+func (sqlServerDialect) LimitOffset(limit, offset int64, ordered bool) (string, []interface{}) {
+	clause := "offset ? rows fetch next ? rows only"
+	if !ordered {
+		clause = fmt.Sprintf("order by (select null) %s", clause)
+	}
+	return clause, []interface{}{offset, limit}
+}
+
+func (sqlServerDialect) OrderItem(field string, desc bool, nulls string) string {
+	return nullsOrderItem(field, desc, nulls)
+}
+
+func (sqlServerDialect) QuoteIdentifier(name string) string {
+	return quoteParts(name, "[", "]")
+}
+
+func (d sqlServerDialect) Upsert(table string, columns, keys []string) string {
+	sources := make([]string, len(columns))
+	names := make([]string, len(columns))
+	values := make([]string, len(columns))
+	var updates, matches []string
+	for i, c := range columns {
+		sources[i] = fmt.Sprintf(":%s as %s", c, d.QuoteIdentifier(c))
+		names[i] = d.QuoteIdentifier(c)
+		values[i] = fmt.Sprintf("source.%s", d.QuoteIdentifier(c))
+		if contains(keys, c) {
+			matches = append(matches, fmt.Sprintf("target.%s = source.%s", d.QuoteIdentifier(c), d.QuoteIdentifier(c)))
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = source.%s", d.QuoteIdentifier(c), d.QuoteIdentifier(c)))
+		}
+	}
+
+	return fmt.Sprintf("merge into %s as target using (select %s) as source on %s when matched then update set %s when not matched then insert (%s) values (%s);",
+		d.QuoteIdentifier(table), strings.Join(sources, ", "), strings.Join(matches, " and "), strings.Join(updates, ", "),
+		strings.Join(names, ", "), strings.Join(values, ", "))
+}
+
+// Returning adds an output clause before the values of the insert
+func (sqlServerDialect) Returning(insert string, columns ...string) string {
+	if len(columns) == 0 {
+		return insert
+	}
+
+	outputs := make([]string, len(columns))
+	for i, c := range columns {
+		outputs[i] = fmt.Sprintf("inserted.%s", c)
+	}
+
+	for _, t := range lexSQL(insert) {
+		if t.depth == 0 && (t.is("values") || t.is("select")) {
+			return splice(insert, t.start, t.start, fmt.Sprintf("output %s", strings.Join(outputs, ", ")))
+		}
+	}
+	return insert
+}
+
+func (sqlServerDialect) Explain(query string) string {
+	return ""
+}
+
+func (sqlServerDialect) SupportsRowValues() bool {
+	return false
+}
+
+// rebindPlaceholders numbers the ? placeholders with the format, the ones in quoted texts and comments are kept.
+// The numbers follow the highest native placeholder of the query written with the same format
+func rebindPlaceholders(query, format string) string {
+	tokens := lexSQL(query)
+	prefix := strings.TrimSuffix(format, "%d")
+
+	n := 0
+	for i := range tokens {
+		if native, ok := nativePlaceholder(tokens, i, prefix); ok && native > n {
+			n = native
+		}
+	}
+
+	var b strings.Builder
+	for _, t := range tokens {
+		if t.kind == tokenPlaceholder && t.text == "?" {
+			n++
+			b.WriteString(fmt.Sprintf(format, n))
+			continue
+		}
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// nativePlaceholder reads the number of the placeholder written with the prefix at the token i: $1 or @p1
+func nativePlaceholder(tokens []sqlToken, i int, prefix string) (int, bool) {
+	text := tokens[i].text
+	if tokens[i].kind == tokenSymbol && text == prefix[:1] && len(prefix) > 1 && i+1 < len(tokens) && tokens[i+1].start == tokens[i].end {
+		// @p1 is split in a symbol and a word
+		text += tokens[i+1].text
+	} else if tokens[i].kind != tokenPlaceholder {
+		return 0, false
+	}
+
+	if len(text) <= len(prefix) || !strings.EqualFold(text[:len(prefix)], prefix) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(text[len(prefix):])
+	return n, err == nil
+}
+
+// nullsOrderItem sorts the nulls with an is null criterion for the databases without nulls first or nulls last
+func nullsOrderItem(field string, desc bool, nulls string) string {
+	item := field
+	if desc {
+		item = fmt.Sprintf("%s desc", item)
+	}
+
+	switch nulls {
+	case NullsFirst:
+		return fmt.Sprintf("case when %s is null then 0 else 1 end, %s", field, item)
+	case NullsLast:
+		return fmt.Sprintf("case when %s is null then 1 else 0 end, %s", field, item)
+	}
+	return item
+}
+
+func quoteParts(name, open, close string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		if p != "*" {
+			parts[i] = open + strings.ReplaceAll(p, close, close+close) + close
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func namedInsert(d Dialect, table string, columns []string) string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = d.QuoteIdentifier(c)
+	}
+	return fmt.Sprintf("insert into %s (%s) values (:%s)", d.QuoteIdentifier(table), strings.Join(names, ", "), strings.Join(columns, ", :"))
+}
+
+// conflictUpsert is the insert on conflict do update of PostgreSQL and SQLite
+func conflictUpsert(d Dialect, table string, columns, keys []string) string {
+	conflict := make([]string, len(keys))
+	for i, k := range keys {
+		conflict[i] = d.QuoteIdentifier(k)
+	}
+
+	updates := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if !contains(keys, c) {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", d.QuoteIdentifier(c), d.QuoteIdentifier(c)))
+		}
+	}
+
+	return fmt.Sprintf("%s on conflict (%s) do update set %s", namedInsert(d, table, columns), strings.Join(conflict, ", "), strings.Join(updates, ", "))
+}
@@ -31,6 +31,55 @@ func GetQuery(e IEntity, filters ...string) string {
 	return sqlPrepareWhere(sqlStmt, filters...)
 }
 
+// GetQueryBuilder is the GetQuery as a *QueryBuilder, each filter is a where condition
+func GetQueryBuilder(e IEntity, filters ...string) *QueryBuilder {
+	return builderWhere(Select(append(GetBaseFields(), e.GetFields()...)...).From(e.GetTableName()), filters...)
+}
+
+// GetSelectedQuery is the GetQuery reading only the fields requested in the params, plus the primary key and sort columns
+func GetSelectedQuery(e IEntity, params ApiParams, filters ...string) string {
+	fields := selectedFields(e, params)
+	if fields == nil {
+		return GetQuery(e, filters...)
+	}
+
+	sqlStmt := fmt.Sprintf("select %s from %s", strings.Join(fields, ", "), e.GetTableName())
+
+	return sqlPrepareWhere(sqlStmt, filters...)
+}
+
+// GetSelectedQueryBuilder is the GetSelectedQuery as a *QueryBuilder
+func GetSelectedQueryBuilder(e IEntity, params ApiParams, filters ...string) *QueryBuilder {
+	fields := selectedFields(e, params)
+	if fields == nil {
+		return GetQueryBuilder(e, filters...)
+	}
+	return builderWhere(Select(fields...).From(e.GetTableName()), filters...)
+}
+
+// selectedFields returns the fields of the entity requested in the params, nil means all of them
+func selectedFields(e IEntity, params ApiParams) []string {
+	selected := selectedColumns(params)
+	if selected == nil {
+		return nil
+	}
+
+	fields := make([]string, 0)
+	for _, f := range append(GetBaseFields(), e.GetFields()...) {
+		if selected[f] {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func builderWhere(b *QueryBuilder, filters ...string) *QueryBuilder {
+	for _, f := range filters {
+		b.Where(f)
+	}
+	return b
+}
+
 func SaveById(e IEntity) string {
 
 	fields := removeForDML(e.GetFields())
@@ -50,10 +99,21 @@ func SaveById(e IEntity) string {
 		return fmt.Sprintf("update %s set %s where id=:id", e.GetTableName(), updateField)
 	}
 
-	return fmt.Sprintf("insert into %s (%s) values (:%s)",
+	insert := fmt.Sprintf("insert into %s (%s) values (:%s)",
 		e.GetTableName(),
 		strings.Join(fields, ", "),
 		strings.Join(fields, ", :"))
+
+	if GetDialect().UsesLastInsertId() {
+		return insert
+	}
+	return GetDialect().Returning(insert, "id")
+}
+
+// UpsertByKeys inserts the entity or updates the line with the same keys, with the syntax of the dialect.
+// Ex: UpsertByKeys(lead, "email")
+func UpsertByKeys(e IEntity, keys ...string) string {
+	return GetDialect().Upsert(e.GetTableName(), removeForDML(e.GetFields()), keys)
 }
 
 func removeForDML(s []string) []string {
@@ -9,6 +9,7 @@ type FieldBuilder struct {
 	tableAlias string
 	fields     []string
 	exclude    []string
+	selected   map[string]bool
 }
 
 func CreateFieldBuilder() *FieldBuilder {
@@ -30,7 +31,28 @@ func (Builder *FieldBuilder) ExcludeFields(fieldsToExclude []string) *FieldBuild
 	return Builder
 }
 
+// SelectFields narrows the fields to the ones requested in the params, keeping the primary key and the sort columns
+func (Builder *FieldBuilder) SelectFields(params ApiParams) *FieldBuilder {
+	Builder.selected = selectedColumns(params)
+	return Builder
+}
+
 func (Builder *FieldBuilder) Build() string {
+	return strings.Join(Builder.finalFields(), fmt.Sprintf(", %s.", Builder.tableAlias))
+}
+
+// Select starts a *QueryBuilder reading the fields, prefixed with the table alias when there is one
+func (Builder *FieldBuilder) Select() *QueryBuilder {
+	columns := Builder.finalFields()
+	if len(Builder.tableAlias) > 0 {
+		for i, c := range columns {
+			columns[i] = fmt.Sprintf("%s.%s", Builder.tableAlias, c)
+		}
+	}
+	return Select(columns...)
+}
+
+func (Builder *FieldBuilder) finalFields() []string {
 
 	finalFields := make([]string, 0)
 
@@ -41,10 +63,13 @@ func (Builder *FieldBuilder) Build() string {
 				foundFlag = true
 			}
 		}
+		if Builder.selected != nil && !Builder.selected[fieldElement] {
+			foundFlag = true
+		}
 		if !foundFlag {
 			finalFields = append(finalFields, fieldElement)
 		}
 	}
 
-	return strings.Join(finalFields, fmt.Sprintf(", %s.", Builder.tableAlias))
+	return finalFields
 }
@@ -0,0 +1,101 @@
+package poctools
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// selectedColumns returns the columns to be read for the requested fields, nil means all of them.
+// The primary key and the sort columns are always kept so the pagination still works
+func selectedColumns(p ApiParams) map[string]bool {
+	if len(p.Fields) == 0 {
+		return nil
+	}
+
+	key := keyField(p)
+
+	columns := map[string]bool{}
+	orders := append(append([]Order{}, p.Orders...), Order{OrderField: key})
+	for _, c := range append(orderColumns(orders), p.Fields...) {
+		columns[c] = true
+	}
+	return columns
+}
+
+func (r PaginationResponse[T]) MarshalJSON() ([]byte, error) {
+	data, err := r.jsonData()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(struct {
+		Data       interface{}              `json:"data"`
+		Pagination PaginationNavigationData `json:"pagination"`
+	}{data, r.Pagination})
+}
+
+// jsonData returns the data to be written in json, only with the requested fields
+func (r PaginationResponse[T]) jsonData() (interface{}, error) {
+	if len(r.fields) == 0 || r.Data == nil {
+		return r.Data, nil
+	}
+	return sparseData(*r.Data, r.fields)
+}
+
+// sparseData keeps only the requested fields of each line
+func sparseData(data interface{}, fields []string) ([]map[string]json.RawMessage, error) {
+	rows := reflect.ValueOf(data)
+	keys := jsonKeys(rows.Type().Elem(), fields)
+
+	result := make([]map[string]json.RawMessage, rows.Len())
+	for i := range result {
+		line, err := json.Marshal(rows.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		var all map[string]json.RawMessage
+		if err = json.Unmarshal(line, &all); err != nil {
+			return nil, err
+		}
+
+		result[i] = map[string]json.RawMessage{}
+		for k, v := range all {
+			if keys[k] {
+				result[i][k] = v
+			}
+		}
+	}
+	return result, nil
+}
+
+// jsonKeys returns the json names of the requested fields, a struct field is matched by its db column or by its json name
+func jsonKeys(t reflect.Type, fields []string) map[string]bool {
+	keys := map[string]bool{}
+	for _, f := range fields {
+		keys[f] = true
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return keys
+	}
+
+	structMap := rowMapper().TypeMap(t)
+	for _, f := range fields {
+		fi := structMap.GetByPath(f)
+		if fi == nil {
+			continue
+		}
+
+		name := strings.Split(fi.Field.Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = fi.Field.Name
+		}
+		keys[name] = true
+	}
+	return keys
+}
@@ -0,0 +1,412 @@
+package poctools
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxExpressionDepth limits the nesting of groups in a filter expression
+const maxExpressionDepth = 32
+
+// Condition is an already compiled sql condition with its bound arguments
+type Condition struct {
+	Sql  string
+	Args []interface{}
+	// Aggregate tells that the condition is on aggregates, it goes to the having clause like the aggregate filters
+	Aggregate bool
+}
+
+// FilterNode is a node of the AST of a filter expression
+type FilterNode interface {
+	compile(fields []Filter, pars []interface{}, verr *ValidationError) (string, []interface{})
+}
+
+// AndNode matches when all its children match
+type AndNode struct {
+	Children []FilterNode
+}
+
+// OrNode matches when any of its children matches
+type OrNode struct {
+	Children []FilterNode
+}
+
+// NotNode negates its child
+type NotNode struct {
+	Child FilterNode
+}
+
+// ComparisonNode compares the field exposed as Selector with the given values
+type ComparisonNode struct {
+	Selector string
+	Operator string
+	Values   []string
+}
+
+// ParseFilterExpression parses a filter expression in a RSQL/FIQL like grammar. Ex:
+//
+//	status==open,(owner==me;priority=gt=3)
+//	status==open or (owner==me and priority>3)
+//
+// ";" or "and" joins conditions, "," or "or" is the alternative and "!" or "not" negates a group.
+// Operators: == != > >= < <= =gt= =ge= =lt= =le= =like= =in=(a,b)
+// Values with spaces or reserved characters must be quoted with ' or "
+func ParseFilterExpression(expression string) (FilterNode, error) {
+	p := &expressionParser{input: []rune(expression)}
+
+	node, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", string(p.peek()))
+	}
+	return node, nil
+}
+
+// CompileFilterExpression turns the AST into a parameterized condition, only the given filters can be used
+func CompileFilterExpression(node FilterNode, fields []Filter) (Condition, error) {
+	verr := &ValidationError{}
+	sql, pars := node.compile(fields, nil, verr)
+	if err := verr.orNil(); err != nil {
+		return Condition{}, err
+	}
+
+	// a condition is either in the where or in the having clause, it can not mix both kinds of fields
+	aggregate, plain := usedFieldKinds(node, fields)
+	if aggregate && plain {
+		verr.add("filter", "", "mixes aggregate and non aggregate fields")
+		return Condition{}, verr
+	}
+	return Condition{Sql: sql, Args: pars, Aggregate: aggregate}, nil
+}
+
+// usedFieldKinds tells if the expression compares aggregate filters and if it compares the other ones
+func usedFieldKinds(node FilterNode, fields []Filter) (aggregate bool, plain bool) {
+	var children []FilterNode
+	switch n := node.(type) {
+	case AndNode:
+		children = n.Children
+	case OrNode:
+		children = n.Children
+	case NotNode:
+		children = []FilterNode{n.Child}
+	case ComparisonNode:
+		if filter := FindFilterByKey(n.Selector, fields); filter != nil {
+			return filter.Aggregate, !filter.Aggregate
+		}
+	}
+
+	for _, child := range children {
+		a, p := usedFieldKinds(child, fields)
+		aggregate, plain = aggregate || a, plain || p
+	}
+	return aggregate, plain
+}
+
+func (n AndNode) compile(fields []Filter, pars []interface{}, verr *ValidationError) (string, []interface{}) {
+	return compileGroup(n.Children, " and ", fields, pars, verr)
+}
+
+func (n OrNode) compile(fields []Filter, pars []interface{}, verr *ValidationError) (string, []interface{}) {
+	return compileGroup(n.Children, " or ", fields, pars, verr)
+}
+
+func (n NotNode) compile(fields []Filter, pars []interface{}, verr *ValidationError) (string, []interface{}) {
+	var condition string
+	condition, pars = n.Child.compile(fields, pars, verr)
+	return fmt.Sprintf("not (%s)", condition), pars
+}
+
+func (n ComparisonNode) compile(fields []Filter, pars []interface{}, verr *ValidationError) (string, []interface{}) {
+	param := fmt.Sprintf("filter.%s", n.Selector)
+
+	filter := FindFilterByKey(n.Selector, fields)
+	if filter == nil {
+		verr.add(param, strings.Join(n.Values, ","), "unknown field")
+		return "", pars
+	}
+	if !filter.allows(n.Operator) {
+		verr.add(param, strings.Join(n.Values, ","), "operator not allowed")
+		return "", pars
+	}
+
+	f := *filter
+	f.Operator = n.Operator
+	f.Value = n.Values[0]
+	if n.Operator == OperatorIn {
+		if len(n.Values) > f.maxValues() {
+			verr.add(param, strings.Join(n.Values, ","), fmt.Sprintf("accepts at most %d values", f.maxValues()))
+			return "", pars
+		}
+		f.Values = n.Values
+	} else if len(n.Values) > 1 {
+		verr.add(param, strings.Join(n.Values, ","), "accepts a single value")
+		return "", pars
+	}
+
+	invalid := len(verr.Errors)
+	if f.coerce(param, verr); len(verr.Errors) > invalid {
+		return "", pars
+	}
+	return filterCondition(f, pars)
+}
+
+func compileGroup(children []FilterNode, separator string, fields []Filter, pars []interface{}, verr *ValidationError) (string, []interface{}) {
+	conditions := make([]string, len(children))
+	for i, child := range children {
+		conditions[i], pars = child.compile(fields, pars, verr)
+	}
+	return fmt.Sprintf("(%s)", strings.Join(conditions, separator)), pars
+}
+
+type expressionParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *expressionParser) parseOr(depth int) (FilterNode, error) {
+	return p.parseList(depth, ',', "or", func(children []FilterNode) FilterNode { return OrNode{Children: children} }, p.parseAnd)
+}
+
+func (p *expressionParser) parseAnd(depth int) (FilterNode, error) {
+	return p.parseList(depth, ';', "and", func(children []FilterNode) FilterNode { return AndNode{Children: children} }, p.parseUnary)
+}
+
+// parseList reads operands joined by the given separator or keyword
+func (p *expressionParser) parseList(depth int, separator rune, keyword string, group func([]FilterNode) FilterNode, operand func(int) (FilterNode, error)) (FilterNode, error) {
+	var children []FilterNode
+	for {
+		node, err := operand(depth)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+
+		p.skipSpaces()
+		if p.peek() == separator {
+			p.pos++
+		} else if !p.consumeKeyword(keyword) {
+			break
+		}
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return group(children), nil
+}
+
+func (p *expressionParser) parseUnary(depth int) (FilterNode, error) {
+	if depth > maxExpressionDepth {
+		return nil, p.errorf("expression nested too deeply")
+	}
+
+	p.skipSpaces()
+	negated := p.consumeKeyword("not")
+	if !negated && p.peek() == '!' {
+		p.pos++
+		negated = true
+	}
+	if negated {
+		child, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return NotNode{Child: child}, nil
+	}
+
+	if p.peek() == '(' {
+		p.pos++
+		node, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.peek() != ')' {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *expressionParser) parseComparison() (FilterNode, error) {
+	start := p.pos
+	for !p.eof() && (unicode.IsLetter(p.peek()) || unicode.IsDigit(p.peek()) || p.peek() == '_' || p.peek() == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, p.errorf("field name expected")
+	}
+	selector := string(p.input[start:p.pos])
+
+	p.skipSpaces()
+	operator, err := p.parseOperator()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	var values []string
+	if p.peek() == '(' {
+		p.pos++
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+
+			p.skipSpaces()
+			if p.peek() == ',' {
+				p.pos++
+				continue
+			}
+			if p.peek() != ')' {
+				return nil, p.errorf("missing closing parenthesis")
+			}
+			p.pos++
+			break
+		}
+	} else {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return ComparisonNode{Selector: selector, Operator: operator, Values: values}, nil
+}
+
+var expressionOperators = map[string]string{
+	"eq":   OperatorEq,
+	"ne":   OperatorNe,
+	"gt":   OperatorGt,
+	"ge":   OperatorGte,
+	"lt":   OperatorLt,
+	"le":   OperatorLte,
+	"like": OperatorLike,
+	"in":   OperatorIn,
+}
+
+func (p *expressionParser) parseOperator() (string, error) {
+	symbols := []struct {
+		symbol   string
+		operator string
+	}{
+		{"==", OperatorEq},
+		{"!=", OperatorNe},
+		{">=", OperatorGte},
+		{"<=", OperatorLte},
+		{">", OperatorGt},
+		{"<", OperatorLt},
+	}
+	for _, s := range symbols {
+		if p.consume(s.symbol) {
+			return s.operator, nil
+		}
+	}
+
+	if p.peek() != '=' {
+		return "", p.errorf("operator expected")
+	}
+	p.pos++
+
+	// "=name=" operators, a lonely "=" is the equality
+	end := p.pos
+	for end < len(p.input) && unicode.IsLetter(p.input[end]) {
+		end++
+	}
+	if end < len(p.input) && end > p.pos && p.input[end] == '=' {
+		name := string(p.input[p.pos:end])
+		operator, found := expressionOperators[name]
+		if !found {
+			return "", p.errorf("unknown operator =%s=", name)
+		}
+		p.pos = end + 1
+		return operator, nil
+	}
+	return OperatorEq, nil
+}
+
+func (p *expressionParser) parseValue() (string, error) {
+	p.skipSpaces()
+
+	if quote := p.peek(); quote == '\'' || quote == '"' {
+		p.pos++
+		var sb strings.Builder
+		for !p.eof() {
+			c := p.peek()
+			p.pos++
+			if c == '\\' && !p.eof() {
+				sb.WriteRune(p.peek())
+				p.pos++
+				continue
+			}
+			if c == quote {
+				return sb.String(), nil
+			}
+			sb.WriteRune(c)
+		}
+		return "", p.errorf("unterminated quoted value")
+	}
+
+	start := p.pos
+	for !p.eof() && !unicode.IsSpace(p.peek()) && !strings.ContainsRune("();,'\"", p.peek()) {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("value expected")
+	}
+	return string(p.input[start:p.pos]), nil
+}
+
+// consumeKeyword reads a case insensitive keyword followed by a space or a parenthesis
+func (p *expressionParser) consumeKeyword(keyword string) bool {
+	end := p.pos + len(keyword)
+	if end >= len(p.input) || !strings.EqualFold(string(p.input[p.pos:end]), keyword) {
+		return false
+	}
+	if !unicode.IsSpace(p.input[end]) && p.input[end] != '(' {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *expressionParser) consume(symbol string) bool {
+	end := p.pos + len([]rune(symbol))
+	if end > len(p.input) || string(p.input[p.pos:end]) != symbol {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *expressionParser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *expressionParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *expressionParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *expressionParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, a...), p.pos)
+}
@@ -0,0 +1,230 @@
+package poctools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFilterExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       FilterNode
+	}{
+		{
+			name:       "comparison",
+			expression: "status==open",
+			want:       ComparisonNode{Selector: "status", Operator: OperatorEq, Values: []string{"open"}},
+		},
+		{
+			name:       "lonely equal sign",
+			expression: "status=open",
+			want:       ComparisonNode{Selector: "status", Operator: OperatorEq, Values: []string{"open"}},
+		},
+		{
+			name:       "symbol operators",
+			expression: "a!=1;b>2;c>=3;d<4;e<=5",
+			want: AndNode{Children: []FilterNode{
+				ComparisonNode{Selector: "a", Operator: OperatorNe, Values: []string{"1"}},
+				ComparisonNode{Selector: "b", Operator: OperatorGt, Values: []string{"2"}},
+				ComparisonNode{Selector: "c", Operator: OperatorGte, Values: []string{"3"}},
+				ComparisonNode{Selector: "d", Operator: OperatorLt, Values: []string{"4"}},
+				ComparisonNode{Selector: "e", Operator: OperatorLte, Values: []string{"5"}},
+			}},
+		},
+		{
+			name:       "named operators",
+			expression: "a=gt=1,b=like=x,c=in=(1, 2,'3 4')",
+			want: OrNode{Children: []FilterNode{
+				ComparisonNode{Selector: "a", Operator: OperatorGt, Values: []string{"1"}},
+				ComparisonNode{Selector: "b", Operator: OperatorLike, Values: []string{"x"}},
+				ComparisonNode{Selector: "c", Operator: OperatorIn, Values: []string{"1", "2", "3 4"}},
+			}},
+		},
+		{
+			name:       "and binds tighter than or",
+			expression: "a==1,b==2;c==3",
+			want: OrNode{Children: []FilterNode{
+				ComparisonNode{Selector: "a", Operator: OperatorEq, Values: []string{"1"}},
+				AndNode{Children: []FilterNode{
+					ComparisonNode{Selector: "b", Operator: OperatorEq, Values: []string{"2"}},
+					ComparisonNode{Selector: "c", Operator: OperatorEq, Values: []string{"3"}},
+				}},
+			}},
+		},
+		{
+			name:       "keywords and groups",
+			expression: "status==open or (owner==me AND priority>3)",
+			want: OrNode{Children: []FilterNode{
+				ComparisonNode{Selector: "status", Operator: OperatorEq, Values: []string{"open"}},
+				AndNode{Children: []FilterNode{
+					ComparisonNode{Selector: "owner", Operator: OperatorEq, Values: []string{"me"}},
+					ComparisonNode{Selector: "priority", Operator: OperatorGt, Values: []string{"3"}},
+				}},
+			}},
+		},
+		{
+			name:       "negations",
+			expression: "!(a==1);not b==2",
+			want: AndNode{Children: []FilterNode{
+				NotNode{Child: ComparisonNode{Selector: "a", Operator: OperatorEq, Values: []string{"1"}}},
+				NotNode{Child: ComparisonNode{Selector: "b", Operator: OperatorEq, Values: []string{"2"}}},
+			}},
+		},
+		{
+			name:       "quoted values",
+			expression: `name=="a;b, c" ; note=='it\'s'`,
+			want: AndNode{Children: []FilterNode{
+				ComparisonNode{Selector: "name", Operator: OperatorEq, Values: []string{"a;b, c"}},
+				ComparisonNode{Selector: "note", Operator: OperatorEq, Values: []string{"it's"}},
+			}},
+		},
+		{
+			name:       "keyword prefix of a field",
+			expression: "order==1",
+			want:       ComparisonNode{Selector: "order", Operator: OperatorEq, Values: []string{"1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilterExpression(tt.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       string
+	}{
+		{"empty", "", "field name expected at position 0"},
+		{"missing operator", "status", "operator expected at position 6"},
+		{"unknown operator", "a=between=1", "unknown operator =between= at position 2"},
+		{"missing value", "a==", "value expected at position 3"},
+		{"unterminated quote", "a=='open", "unterminated quoted value at position 8"},
+		{"missing closing parenthesis", "(a==1", "missing closing parenthesis at position 5"},
+		{"unclosed value list", "a=in=(1,2", "missing closing parenthesis at position 9"},
+		{"trailing text", "a==1)", `unexpected ")" at position 4`},
+		{"dangling separator", "a==1;", "field name expected at position 5"},
+		{"too deep", strings.Repeat("(", maxExpressionDepth+2) + "a==1", "expression nested too deeply at position 33"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFilterExpression(tt.expression)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("got %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterExpression(t *testing.T) {
+	fields := []Filter{
+		{Name: "status", WhereField: "o.status", Operators: []string{OperatorIn}},
+		{Name: "priority", WhereField: "priority", Type: FilterTypeInt, Operators: []string{OperatorGt}},
+		{Name: "name", WhereField: "name", Operators: []string{OperatorLike}},
+		RawFilter(Filter{Name: "total", WhereField: "sum(amount)", Type: FilterTypeInt, Operators: []string{OperatorGt}, Aggregate: true}),
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		sql        string
+		args       []interface{}
+		aggregate  bool
+	}{
+		{
+			name:       "comparisons",
+			expression: "status==open,priority>3",
+			sql:        "(`o`.`status`=? or `priority`>?)",
+			args:       []interface{}{"open", int64(3)},
+		},
+		{
+			name:       "in and negation",
+			expression: "!(status=in=(open,closed));name=like=a_b",
+			sql:        "(not (`o`.`status` in (?, ?)) and `name` like ? escape '!')",
+			args:       []interface{}{"open", "closed", "%a!_b%"},
+		},
+		{
+			name:       "aggregate",
+			expression: "total>100",
+			sql:        "sum(amount)>?",
+			args:       []interface{}{int64(100)},
+			aggregate:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := ParseFilterExpression(tt.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c, err := CompileFilterExpression(node, fields)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.Sql != tt.sql {
+				t.Errorf("got %q, want %q", c.Sql, tt.sql)
+			}
+			if !reflect.DeepEqual(c.Args, tt.args) {
+				t.Errorf("got arguments %v, want %v", c.Args, tt.args)
+			}
+			if c.Aggregate != tt.aggregate {
+				t.Errorf("aggregate: got %v, want %v", c.Aggregate, tt.aggregate)
+			}
+		})
+	}
+}
+
+func TestCompileFilterExpressionErrors(t *testing.T) {
+	fields := []Filter{
+		{Name: "status", WhereField: "status", MaxValues: 2, Operators: []string{OperatorIn}},
+		{Name: "priority", WhereField: "priority", Type: FilterTypeInt},
+		RawFilter(Filter{Name: "total", WhereField: "sum(amount)", Aggregate: true}),
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		param      string
+		reason     string
+	}{
+		{"unknown field", "owner==me", "filter.owner", "unknown field"},
+		{"operator not allowed", "priority>3", "filter.priority", "operator not allowed"},
+		{"too many values", "status=in=(a,b,c)", "filter.status", "accepts at most 2 values"},
+		{"several values", "priority==(1,2)", "filter.priority", "accepts a single value"},
+		{"invalid value", "priority==high", "filter.priority", "must be an integer"},
+		{"mixed kinds", "status==open;total==3", "filter", "mixes aggregate and non aggregate fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := ParseFilterExpression(tt.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, err = CompileFilterExpression(node, fields)
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("got %v, want a *ValidationError", err)
+			}
+			if len(verr.Errors) != 1 || verr.Errors[0].Param != tt.param || verr.Errors[0].Reason != tt.reason {
+				t.Errorf("got %v, want %s: %s", verr.Errors, tt.param, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package poctools
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies defines the proxies, IPs or CIDRs, whose X-Forwarded-Proto, X-Forwarded-Host and
+// X-Forwarded-Prefix headers are used to build the navigation links
+func SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %s: %w", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	trustedProxies = nets
+	return nil
+}
+
+// GenerateBaseURLFromRequest returns the scheme, host and prefix of the public URL of the API.
+// The PublicBaseURL wins, then the forwarded headers of trusted proxies. Empty means relative links
+func GenerateBaseURLFromRequest(c *gin.Context) string {
+	if len(PublicBaseURL) > 0 {
+		return strings.TrimSuffix(PublicBaseURL, "/")
+	}
+
+	if !isTrustedProxy(c.RemoteIP()) {
+		return ""
+	}
+
+	host := lastForwardedValue(c.GetHeader("X-Forwarded-Host"))
+	if len(host) == 0 || strings.ContainsAny(host, "/\\@ ") {
+		return ""
+	}
+
+	scheme := strings.ToLower(lastForwardedValue(c.GetHeader("X-Forwarded-Proto")))
+	if scheme != "http" && scheme != "https" {
+		scheme = "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+	}
+
+	prefix := strings.TrimSuffix(lastForwardedValue(c.GetHeader("X-Forwarded-Prefix")), "/")
+	if len(prefix) > 0 && (!strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "//") || strings.ContainsAny(prefix, "?# ")) {
+		prefix = ""
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, host, prefix)
+}
+
+func isTrustedProxy(remoteIP string) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastForwardedValue returns the last value of a comma separated header, the one appended by the trusted proxy.
+// The values before it were sent by the client or the proxies in front of it, they can not be trusted
+func lastForwardedValue(header string) string {
+	values := strings.Split(header, ",")
+	return strings.TrimSpace(values[len(values)-1])
+}
@@ -0,0 +1,116 @@
+package poctools
+
+import (
+	"fmt"
+)
+
+// RawFilter marks the WhereField of the filter as a sql expression written as it is, ex: sum(o.amount).
+// The expression must never come from the client
+func RawFilter(f Filter) Filter {
+	f.raw = true
+	return f
+}
+
+// RawOrder marks the OrderField of the order as a sql expression written as it is, ex: lower(u.name).
+// The expression must never come from the client, keyset pagination needs its Column
+func RawOrder(o Order) Order {
+	o.raw = true
+	return o
+}
+
+// RegisterFilters checks the filters at startup: a WhereField must be a column or an alias.column,
+// unless the filter is a RawFilter
+func RegisterFilters(filters ...Filter) ([]Filter, error) {
+	for _, f := range filters {
+		if !f.raw && !isIdentifier(f.WhereField) {
+			return nil, fmt.Errorf("filter %q: %q is not a column nor an alias.column, use RawFilter for an expression", f.Name, f.WhereField)
+		}
+	}
+	return filters, nil
+}
+
+// RegisterOrders checks the orders at startup: an OrderField must be a column or an alias.column,
+// unless the order is a RawOrder
+func RegisterOrders(orders ...Order) ([]Order, error) {
+	for _, o := range orders {
+		if !o.raw && !isIdentifier(o.OrderField) {
+			return nil, fmt.Errorf("order %q: %q is not a column nor an alias.column, use RawOrder for an expression", o.Name, o.OrderField)
+		}
+	}
+	return orders, nil
+}
+
+// RegisterSearch checks the search columns at startup: each one must be a column or an alias.column
+func RegisterSearch(columns ...string) ([]string, error) {
+	for _, column := range columns {
+		if !isIdentifier(column) {
+			return nil, fmt.Errorf("search column %q is not a column nor an alias.column", column)
+		}
+	}
+	return columns, nil
+}
+
+// MustRegisterFilters is RegisterFilters panicking on an invalid filter, for the package variables
+func MustRegisterFilters(filters ...Filter) []Filter {
+	filters, err := RegisterFilters(filters...)
+	if err != nil {
+		panic(err)
+	}
+	return filters
+}
+
+// MustRegisterOrders is RegisterOrders panicking on an invalid order, for the package variables
+func MustRegisterOrders(orders ...Order) []Order {
+	orders, err := RegisterOrders(orders...)
+	if err != nil {
+		panic(err)
+	}
+	return orders
+}
+
+// MustRegisterSearch is RegisterSearch panicking on an invalid column, for the package variables
+func MustRegisterSearch(columns ...string) []string {
+	columns, err := RegisterSearch(columns...)
+	if err != nil {
+		panic(err)
+	}
+	return columns
+}
+
+// isIdentifier tells if the name is a column or an alias.column made of letters, digits and underscores
+func isIdentifier(name string) bool {
+	parts := 0
+	start := true
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '.' && !start && parts == 0:
+			parts, start = 1, true
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start = false
+		case isSQLDigit(c) && !start:
+		default:
+			return false
+		}
+	}
+	return !start
+}
+
+// field returns the WhereField as written in the sql, quoted by the dialect unless raw
+func (f Filter) field() string {
+	return sqlField(f.WhereField, f.raw)
+}
+
+// field returns the OrderField as written in the sql, quoted by the dialect unless raw
+func (o Order) field() string {
+	return sqlField(o.OrderField, o.raw)
+}
+
+// sqlField quotes the identifiers through the dialect when the queries are written,
+// so they follow the dialect chosen by SetDbEngine after the registration
+func sqlField(name string, raw bool) string {
+	if raw {
+		return name
+	}
+	return GetDialect().QuoteIdentifier(name)
+}
@@ -0,0 +1,278 @@
+package poctools
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// keysetOrders returns the sort criteria of a keyset page, always ending with the primary key as tie breaker
+func keysetOrders(p ApiParams) []Order {
+	key := keyField(p)
+
+	orders := append([]Order{}, p.Orders...)
+	if len(orders) == 0 {
+		return []Order{{OrderField: key}}
+	}
+
+	last := orders[len(orders)-1]
+	if last.OrderField != key {
+		orders = append(orders, Order{OrderField: key, Desc: last.Desc})
+	}
+	return orders
+}
+
+// keyField returns the primary key of the params, id when it is not set
+func keyField(p ApiParams) string {
+	if len(p.KeyField) == 0 {
+		return "id"
+	}
+	return p.KeyField
+}
+
+// isBackwardPage tells if the lines of the keyset page are read in the reversed sort order.
+// It happens for the last page and for backward cursors, a negative limit flips the direction of the cursor
+func isBackwardPage(p ApiParams) bool {
+	if p.Pagination.Marker == "last" {
+		return true
+	}
+
+	cursor, err := p.Pagination.cursor()
+	return err == nil && cursor.Backward != (p.Pagination.Limit < 0)
+}
+
+// getKeysetPaginatedQuery seeks the lines after the cursor instead of skipping an offset
+func getKeysetPaginatedQuery(query string, p ApiParams) (result string, paginationParams []interface{}, err error) {
+	return pageSQL(query, p, keysetPaginate)
+}
+
+func keysetPaginate(q pagedQuery, p ApiParams) error {
+	orders := keysetOrders(p)
+	reversed := isBackwardPage(p)
+
+	cursor, err := p.Pagination.cursor()
+	if err != nil {
+		return err
+	}
+
+	if len(cursor.Values) > 0 {
+		if len(cursor.Values) != len(orders) {
+			return &CursorError{Reason: "the cursor does not match the sort order"}
+		}
+
+		q.filter(nil, []Condition{keysetCondition(orders, cursor.Values, reversed)})
+	}
+
+	q.addOrderBy(orderByClause(orders, reversed))
+	q.setLimit(GetDialect().LimitOffset(absLimit(p.Pagination.Limit)+lookahead(p), 0, true))
+	return nil
+}
+
+// keysetCondition selects the lines after the cursor values, or before them when backward.
+// Sorts in a single direction use a row comparison: (a, b, id) > (?, ?, ?)
+// Mixed directions, dialects without row comparisons or null values are expanded: (a > ?) or (a = ? and b < ?) or ...
+// The last order is the primary key, it is never null
+func keysetCondition(orders []Order, values []interface{}, backward bool) Condition {
+	sameDirection := GetDialect().SupportsRowValues()
+	for i, o := range orders {
+		if o.Desc != orders[0].Desc || values[i] == nil {
+			sameDirection = false
+		}
+		// a row comparison skips the null lines, they must be before the cursor
+		if i < len(orders)-1 && nullsAfterValues(o, backward) {
+			sameDirection = false
+		}
+	}
+
+	if sameDirection {
+		fields := make([]string, len(orders))
+		placeholders := make([]string, len(orders))
+		for i, o := range orders {
+			fields[i] = o.field()
+			placeholders[i] = "?"
+		}
+		return Condition{
+			Sql: fmt.Sprintf("(%s) %s (%s)", strings.Join(fields, ", "),
+				keysetOperator(orders[0].Desc, backward), strings.Join(placeholders, ", ")),
+			Args: values,
+		}
+	}
+
+	var alternatives []string
+	var args []interface{}
+	for i, o := range orders {
+		after, afterArgs := keysetAfter(o, values[i], backward, i < len(orders)-1)
+		if len(after) == 0 {
+			continue
+		}
+
+		var parts []string
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				parts = append(parts, fmt.Sprintf("%s is null", orders[j].field()))
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%s = ?", orders[j].field()))
+			args = append(args, values[j])
+		}
+		parts = append(parts, after)
+		args = append(args, afterArgs...)
+		alternatives = append(alternatives, fmt.Sprintf("(%s)", strings.Join(parts, " and ")))
+	}
+
+	if len(alternatives) == 0 {
+		return Condition{Sql: "1 = 0"}
+	}
+	return Condition{Sql: strings.Join(alternatives, " or "), Args: args}
+}
+
+// keysetAfter selects the values of the order read after the cursor value, empty when there are none.
+// The null lines of a nullable order are after the other ones or before them, according to its nulls placement
+func keysetAfter(o Order, value interface{}, backward, nullable bool) (string, []interface{}) {
+	nullsAfter := nullable && nullsAfterValues(o, backward)
+	if value == nil {
+		if nullsAfter {
+			return "", nil
+		}
+		return fmt.Sprintf("%s is not null", o.field()), nil
+	}
+
+	after := fmt.Sprintf("%s %s ?", o.field(), keysetOperator(o.Desc, backward))
+	if nullsAfter {
+		after = fmt.Sprintf("(%s or %s is null)", after, o.field())
+	}
+	return after, []interface{}{value}
+}
+
+// nullsAfterValues tells if the null lines of the order are read after the other ones,
+// an order without nulls placement has the one of the dialect
+func nullsAfterValues(o Order, backward bool) bool {
+	last := o.Nulls == NullsLast
+	if len(o.Nulls) == 0 {
+		last = GetDialect().NullsLargest() != o.Desc
+	}
+	return last != backward
+}
+
+func keysetOperator(desc, backward bool) string {
+	if desc != backward {
+		return "<"
+	}
+	return ">"
+}
+
+// getKeysetCursors builds the cursors of the pages around the given lines, nil when there is no such page
+func getKeysetCursors(p ApiParams, count PageCount, list interface{}) (previous, next *CursorState, err error) {
+	rows := reflect.Indirect(reflect.ValueOf(list))
+	if rows.Kind() != reflect.Slice || rows.Len() == 0 {
+		return nil, nil, nil
+	}
+
+	orders := keysetOrders(p)
+	// the line read after the page tells if it is followed by more lines
+	full := count.More
+
+	hasPrevious := len(p.Pagination.Marker) > 0
+	hasNext := full
+	if isBackwardPage(p) {
+		hasPrevious = full
+		hasNext = len(p.Pagination.Marker) > 0 && p.Pagination.Marker != "last"
+	}
+
+	// the cursors are used with the same limit, a negative one flips their direction
+	negative := p.Pagination.Limit < 0
+	if hasPrevious {
+		previous, err = rowCursor(rows.Index(0), orders, !negative)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if hasNext {
+		next, err = rowCursor(rows.Index(rows.Len()-1), orders, negative)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return previous, next, nil
+}
+
+func rowCursor(row reflect.Value, orders []Order, backward bool) (*CursorState, error) {
+	values, err := rowValues(row, orderColumns(orders))
+	if err != nil {
+		return nil, err
+	}
+	return &CursorState{Values: values, Backward: backward}, nil
+}
+
+// orderColumns returns the result columns holding the values of the sort fields
+func orderColumns(orders []Order) []string {
+	columns := make([]string, len(orders))
+	for i, o := range orders {
+		columns[i] = o.Column
+		if len(columns[i]) == 0 {
+			columns[i] = o.OrderField[strings.LastIndex(o.OrderField, ".")+1:]
+		}
+	}
+	return columns
+}
+
+// rowValues reads the given columns from a result line, a struct mapped with db tags or a map
+func rowValues(row reflect.Value, columns []string) ([]interface{}, error) {
+	for row.Kind() == reflect.Interface || row.Kind() == reflect.Ptr {
+		row = row.Elem()
+	}
+
+	values := make([]interface{}, len(columns))
+	switch row.Kind() {
+	case reflect.Map:
+		for i, column := range columns {
+			v := row.MapIndex(reflect.ValueOf(column))
+			if !v.IsValid() {
+				return nil, fmt.Errorf("missing column %s in the result", column)
+			}
+			values[i] = v.Interface()
+		}
+	case reflect.Struct:
+		traversals := rowMapper().TraversalsByName(row.Type(), columns)
+		for i, t := range traversals {
+			if len(t) == 0 {
+				return nil, fmt.Errorf("missing column %s in the result", columns[i])
+			}
+			values[i] = reflectx.FieldByIndexesReadOnly(row, t).Interface()
+		}
+	default:
+		return nil, fmt.Errorf("unable to read columns from %s", row.Kind())
+	}
+
+	for i, v := range values {
+		values[i] = cursorValue(v)
+	}
+	return values, nil
+}
+
+// cursorValue converts a column value in a value that survives the json encoding
+func cursorValue(v interface{}) interface{} {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if value, err := valuer.Value(); err == nil {
+			v = value
+		}
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+func rowMapper() *reflectx.Mapper {
+	if GetDbEngine() != nil {
+		return GetDbEngine().Mapper
+	}
+	return reflectx.NewMapperFunc("db", strings.ToLower)
+}
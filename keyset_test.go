@@ -0,0 +1,141 @@
+package poctools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeysetCondition(t *testing.T) {
+	dialects := []Dialect{MySQL, PostgreSQL, SQLite, SQLServer}
+
+	tests := []struct {
+		name     string
+		orders   []Order
+		values   []interface{}
+		backward bool
+		// want is the condition of each dialect, by its name
+		want map[string]string
+		args map[string][]interface{}
+	}{
+		{
+			name:   "single direction",
+			orders: []Order{{OrderField: "name"}, {OrderField: "id"}},
+			values: []interface{}{"bob", int64(3)},
+			want: map[string]string{
+				// the nulls are the smallest values, they are before the cursor
+				"mysql":     "(`name`, `id`) > (?, ?)",
+				"postgres":  `(("name" > ? or "name" is null)) or ("name" = ? and "id" > ?)`,
+				"sqlite":    `("name", "id") > (?, ?)`,
+				"sqlserver": "([name] > ?) or ([name] = ? and [id] > ?)",
+			},
+			args: map[string][]interface{}{
+				"mysql":     {"bob", int64(3)},
+				"postgres":  {"bob", "bob", int64(3)},
+				"sqlite":    {"bob", int64(3)},
+				"sqlserver": {"bob", "bob", int64(3)},
+			},
+		},
+		{
+			name:   "mixed directions",
+			orders: []Order{{OrderField: "name", Desc: true}, {OrderField: "id"}},
+			values: []interface{}{"bob", int64(3)},
+			want: map[string]string{
+				"mysql":     "((`name` < ? or `name` is null)) or (`name` = ? and `id` > ?)",
+				"postgres":  `("name" < ?) or ("name" = ? and "id" > ?)`,
+				"sqlite":    `(("name" < ? or "name" is null)) or ("name" = ? and "id" > ?)`,
+				"sqlserver": "(([name] < ? or [name] is null)) or ([name] = ? and [id] > ?)",
+			},
+			args: map[string][]interface{}{
+				"mysql":     {"bob", "bob", int64(3)},
+				"postgres":  {"bob", "bob", int64(3)},
+				"sqlite":    {"bob", "bob", int64(3)},
+				"sqlserver": {"bob", "bob", int64(3)},
+			},
+		},
+		{
+			name:     "backward with nulls last",
+			orders:   []Order{{OrderField: "name", Nulls: NullsLast}, {OrderField: "id"}},
+			values:   []interface{}{"bob", int64(3)},
+			backward: true,
+			want: map[string]string{
+				// read backward the nulls come first, they are after the cursor
+				"mysql":     "(`name`, `id`) < (?, ?)",
+				"postgres":  `("name", "id") < (?, ?)`,
+				"sqlite":    `("name", "id") < (?, ?)`,
+				"sqlserver": "([name] < ?) or ([name] = ? and [id] < ?)",
+			},
+			args: map[string][]interface{}{
+				"mysql":     {"bob", int64(3)},
+				"postgres":  {"bob", int64(3)},
+				"sqlite":    {"bob", int64(3)},
+				"sqlserver": {"bob", "bob", int64(3)},
+			},
+		},
+		{
+			name:   "null cursor value with nulls first",
+			orders: []Order{{OrderField: "name", Nulls: NullsFirst}, {OrderField: "id"}},
+			values: []interface{}{nil, int64(3)},
+			want: map[string]string{
+				"mysql":     "(`name` is not null) or (`name` is null and `id` > ?)",
+				"postgres":  `("name" is not null) or ("name" is null and "id" > ?)`,
+				"sqlite":    `("name" is not null) or ("name" is null and "id" > ?)`,
+				"sqlserver": "([name] is not null) or ([name] is null and [id] > ?)",
+			},
+		},
+		{
+			name:   "null cursor value with nulls last",
+			orders: []Order{{OrderField: "name", Nulls: NullsLast}, {OrderField: "id"}},
+			values: []interface{}{nil, int64(3)},
+			want: map[string]string{
+				"mysql":     "(`name` is null and `id` > ?)",
+				"postgres":  `("name" is null and "id" > ?)`,
+				"sqlite":    `("name" is null and "id" > ?)`,
+				"sqlserver": "([name] is null and [id] > ?)",
+			},
+		},
+		{
+			name:     "null cursor value read backward",
+			orders:   []Order{{OrderField: "name", Nulls: NullsLast}, {OrderField: "id", Desc: true}},
+			values:   []interface{}{nil, int64(3)},
+			backward: true,
+			want: map[string]string{
+				"mysql":     "(`name` is not null) or (`name` is null and `id` > ?)",
+				"postgres":  `("name" is not null) or ("name" is null and "id" > ?)`,
+				"sqlite":    `("name" is not null) or ("name" is null and "id" > ?)`,
+				"sqlserver": "([name] is not null) or ([name] is null and [id] > ?)",
+			},
+		},
+		{
+			name:   "null cursor value with the nulls of the dialect",
+			orders: []Order{{OrderField: "name"}, {OrderField: "id"}},
+			values: []interface{}{nil, int64(3)},
+			want: map[string]string{
+				"mysql":     "(`name` is not null) or (`name` is null and `id` > ?)",
+				"postgres":  `("name" is null and "id" > ?)`,
+				"sqlite":    `("name" is not null) or ("name" is null and "id" > ?)`,
+				"sqlserver": "([name] is not null) or ([name] is null and [id] > ?)",
+			},
+		},
+	}
+
+	defer SetDialect(MySQL)
+	for _, tt := range tests {
+		for _, d := range dialects {
+			t.Run(tt.name+"/"+d.Name(), func(t *testing.T) {
+				SetDialect(d)
+				c := keysetCondition(tt.orders, tt.values, tt.backward)
+				if want := tt.want[d.Name()]; c.Sql != want {
+					t.Errorf("got %q, want %q", c.Sql, want)
+				}
+
+				args, ok := tt.args[d.Name()]
+				if !ok {
+					args = []interface{}{int64(3)}
+				}
+				if !reflect.DeepEqual(c.Args, args) {
+					t.Errorf("got arguments %v, want %v", c.Args, args)
+				}
+			})
+		}
+	}
+}
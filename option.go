@@ -1,7 +1,11 @@
 package poctools
 
 var Option = struct {
-	NoCount string
+	NoCount  string
+	Keyset   string
+	Parallel string
 }{
-	NoCount: "no_count",
+	NoCount:  "no_count",
+	Keyset:   "keyset",
+	Parallel: "parallel",
 }
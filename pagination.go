@@ -2,6 +2,7 @@ package poctools
 
 import (
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -11,6 +12,8 @@ import (
 type paginator[T any] struct {
 	s              SqlExecutor
 	sql            string
+	builder        *QueryBuilder
+	err            error
 	params         ApiParams
 	response       PaginationResponse[T]
 	funcMapDbToDto func(any) []T
@@ -26,8 +29,17 @@ func (p *paginator[T]) WithSqlExecutor(s SqlExecutor) *paginator[T] {
 	return p
 }
 
-func (p *paginator[T]) WithQuery(query string) *paginator[T] {
-	p.sql = query
+// WithQuery sets the query paged, a sql string or a *QueryBuilder.
+// The arguments of a builder are given to its clauses, WithArgs is for the sql strings
+func (p *paginator[T]) WithQuery(query interface{}) *paginator[T] {
+	switch q := query.(type) {
+	case string:
+		p.sql, p.builder = q, nil
+	case *QueryBuilder:
+		p.sql, p.builder = "", q
+	default:
+		p.err = fmt.Errorf("unsupported query type %T", query)
+	}
 	return p
 }
 
@@ -49,56 +61,63 @@ func (p *paginator[T]) WithArgs(args ...interface{}) *paginator[T] {
 func (p *paginator[T]) Do() (*PaginationResponse[T], error) {
 
 	//Todo test if all fields were populated
-	if p.params.Order == nil {
-		p.params.Order = &Order{OrderField: "id"}
+	if p.err != nil {
+		return nil, p.err
 	}
-
-	var totalLines int64
+	if p.builder != nil && len(p.args) > 0 {
+		return nil, fmt.Errorf("the arguments of a query builder are given to its clauses")
+	}
+	var count PageCount
 	var err error
 
 	if p.funcMapDbToDto != nil {
 		resultList := make([]interface{}, 0)
-		totalLines, err = p.s.readManyPaginated(p.sql, &resultList, p.params, p.args...)
+		count, err = p.readPage(&resultList)
 		if err != nil {
-			return nil, fmt.Errorf("unable to read paged object")
+			return nil, fmt.Errorf("unable to read paged object: %w", err)
 		}
 
 		dtos := p.funcMapDbToDto(resultList)
 		p.response.Data = &dtos
-		p.response.Pagination, err = preparePaginationResponse(p.params, totalLines, resultList)
+		p.response.Pagination, err = preparePaginationResponse(p.params, count, resultList)
 		if err != nil {
-			return nil, fmt.Errorf("unable to read paged object")
+			return nil, fmt.Errorf("unable to read paged object: %w", err)
 		}
 
 	} else {
 		resultList := make([]T, 0)
-		totalLines, err = p.s.readManyPaginated(p.sql, &resultList, p.params, p.args...)
+		count, err = p.readPage(&resultList)
 		if err != nil {
-			return nil, fmt.Errorf("unable to read paged object")
+			return nil, fmt.Errorf("unable to read paged object: %w", err)
 		}
 
 		p.response.Data = &resultList
-		p.response.Pagination, err = preparePaginationResponse(p.params, totalLines, resultList)
+		p.response.Pagination, err = preparePaginationResponse(p.params, count, resultList)
 		if err != nil {
-			return nil, fmt.Errorf("unable to read paged object")
+			return nil, fmt.Errorf("unable to read paged object: %w", err)
 		}
 	}
 
+	p.response.fields = p.params.Fields
 	return &p.response, nil
 }
 
+// readPage reads the lines of the page in the list, from the builder or from the sql
+func (p *paginator[T]) readPage(list interface{}) (PageCount, error) {
+	if p.builder != nil {
+		return p.s.readManyPaginatedBuilder(p.builder, list, p.params)
+	}
+	return p.s.readManyPaginated(p.sql, list, p.params, p.args...)
+}
+
 func FindAllPagedMapped[DBE any, DTO any](s SqlExecutor, sql string, params ApiParams, funcMapDbToDto func([]DBE) []DTO, args ...interface{}) (PaginationResponse[DTO], error) {
 
 	response := PaginationResponse[DTO]{}
 
-	if params.Order == nil {
-		params.Order = &Order{OrderField: "id"}
-	}
-
 	resultList := make([]DBE, 0)
-	totalLines, err := s.readManyPaginated(sql, &resultList, params, args...)
+	count, err := s.readManyPaginated(sql, &resultList, params, args...)
 	if err != nil {
-		return response, fmt.Errorf("unable to read paged object")
+		return response, fmt.Errorf("unable to read paged object: %w", err)
 	}
 
 	// Covert the result for DTOs
@@ -106,25 +125,32 @@ func FindAllPagedMapped[DBE any, DTO any](s SqlExecutor, sql string, params ApiP
 	response.Data = &dtos
 
 	// Prepare the pagination response
-	response.Pagination, err = preparePaginationResponse(params, totalLines, resultList)
+	response.Pagination, err = preparePaginationResponse(params, count, resultList)
 	if err != nil {
-		return response, fmt.Errorf("unable to read paged object")
+		return response, fmt.Errorf("unable to read paged object: %w", err)
 	}
+	response.fields = params.Fields
 
 	return response, err
 }
 
-func GeneratePaginationFromRequest(c *gin.Context) Pagination {
+// GeneratePaginationFromRequest reads the pagination parameters through the DefaultPaginationStrategy.
+// With the marker strategies a marker that can not be trusted is reported with a *CursorError
+func GeneratePaginationFromRequest(c *gin.Context) (Pagination, error) {
+	return DefaultPaginationStrategy.Parse(c.Request.URL.Query())
+}
+
+// parseMarkerPagination reads the limit and the marker, decoded by the DefaultCursorCodec
+func parseMarkerPagination(query url.Values) (Pagination, error) {
 	p := Pagination{}
 
-	query := c.Request.URL.Query()
 	for key, value := range query {
 		queryValue := value[len(value)-1]
 		switch key {
 		case "limit":
 			value, err := strconv.ParseInt(queryValue, 10, 64)
 			if err != nil || value == 0 {
-				return getDefaultPaginationRequest()
+				return getDefaultPaginationRequest(), nil
 			}
 			p.Limit = value
 		case "marker":
@@ -133,27 +159,34 @@ func GeneratePaginationFromRequest(c *gin.Context) Pagination {
 	}
 
 	if p.Limit == 0 {
-		return getDefaultPaginationRequest()
+		p.Limit = DefaultPaginationLimit
 	}
 
-	return p
+	if len(p.Marker) > 0 && p.Marker != "last" {
+		cursor, err := DefaultCursorCodec.Decode(p.Marker)
+		if err != nil {
+			return p, err
+		}
+		p.Cursor = &cursor
+	}
+
+	return p, nil
 
 }
 
-func preparePaginationResponse(p ApiParams, totalLines int64, list interface{}) (PaginationNavigationData, error) {
+func preparePaginationResponse(p ApiParams, count PageCount, list interface{}) (PaginationNavigationData, error) {
 
 	var pnd PaginationNavigationData
 	if len(p.RequestedURLPath) == 0 {
 		return pnd, fmt.Errorf("the request URL path is empty")
 	}
 
-	if totalLines == 0 {
+	if count.Exact && count.Total == 0 {
+		pnd.TotalExact = true
 		return pnd, nil
 	}
 
-	nextOffset, previousOffset := computeNextAndPrevious(p.Pagination, totalLines)
-
-	pnd, err := getPaginationNavigationData(p.RequestedURLPath, previousOffset, nextOffset, totalLines, p.Pagination.Limit)
+	pnd, err := paginationStrategy(p).Navigate(p, count, list)
 	if err != nil {
 		return pnd, fmt.Errorf("unable to create pagination data: %w", err)
 	}
@@ -162,10 +195,11 @@ func preparePaginationResponse(p ApiParams, totalLines int64, list interface{})
 }
 
 func computeNextAndPrevious(p Pagination, totalLines int64) (int64, int64) {
-	marker, err := strconv.ParseInt(p.Marker, 10, 64)
+	cursor, err := p.cursor()
 	if err != nil {
-		marker = 0
+		cursor = CursorState{}
 	}
+	marker := cursor.Offset
 
 	nextOffset := marker + p.Limit
 	previousOffset := marker - p.Limit
@@ -188,42 +222,151 @@ func computeNextAndPrevious(p Pagination, totalLines int64) (int64, int64) {
 	return nextOffset, previousOffset
 }
 
+// computeUncountedNextAndPrevious returns the offset markers around a page read without an exact count.
+// The next page is known from the line read after the page, the pages counted from the end can not be reached
+func computeUncountedNextAndPrevious(p Pagination, reversed bool, more bool) (previous, next *CursorState) {
+	cursor, err := p.cursor()
+	if err != nil || reversed {
+		return nil, nil
+	}
+
+	limit := absLimit(p.Limit)
+	start, end := cursor.Offset, cursor.Offset+limit
+	if p.Limit < 0 {
+		// the marker is the exclusive end of the page
+		start, end = cursor.Offset-limit, cursor.Offset
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	if start > 0 {
+		if p.Limit < 0 {
+			previous = &CursorState{Offset: start}
+		} else {
+			previous = &CursorState{Offset: max64(start-limit, 0)}
+		}
+	}
+	if more {
+		if p.Limit < 0 {
+			next = &CursorState{Offset: end + limit}
+		} else {
+			next = &CursorState{Offset: end}
+		}
+	}
+	return previous, next
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// computeBackwardNextAndPrevious returns the markers around a page read with a negative limit.
+// Those markers are the exclusive end of the pages, nil when there is no such page
+func computeBackwardNextAndPrevious(p Pagination, totalLines int64) (next, previous *CursorState) {
+	cursor, err := p.cursor()
+	if err != nil {
+		cursor = CursorState{}
+	}
+
+	end := cursor.Offset
+	if len(p.Marker) == 0 || p.Marker == "last" {
+		end = totalLines
+	}
+	// a marker past the last line reads the lines of its page that exist, the page does not move back
+	start := end + p.Limit
+
+	if start > 0 {
+		previous = &CursorState{Offset: start}
+	}
+	if end < totalLines {
+		next = &CursorState{Offset: end - p.Limit}
+	}
+	return next, previous
+}
+
 /*
 	Fill a PaginationNavigationData instance with values like
 	for urls: /v1/users?marker=auser&limit=100
 
-	urlPath the path used in the url. Ex: "/v1/users" "/v1/leads/"
-	total 	Total number of lines of the table content
+	urlPath the path used in the url, absolute when a base URL is known. Ex: "/v1/users" "https://api.example.com/v1/leads/"
+	query   parameters of the request kept in every link, only marker and limit are replaced
+	previous, next  cursors of the surrounding pages encoded by the DefaultCursorCodec, nil when there is no such page
+	count 	Total number of lines of the table content, the last page is only known when they were exactly counted
 	limit   Limit used to group the total number of lines
 */
-func getPaginationNavigationData(urlPath string, previousMarker, nextMarker int64, total, limit int64) (PaginationNavigationData, error) {
-	p := PaginationNavigationData{}
+func getPaginationNavigationData(urlPath string, query url.Values, previous, next *CursorState, count PageCount, limit int64) (PaginationNavigationData, error) {
+	p := PaginationNavigationData{TotalExact: count.Exact}
 
-	var sb strings.Builder
-	sb.WriteString(urlPath)
+	links, err := newLinkBuilder(urlPath, query)
+	if err != nil {
+		return p, err
+	}
 
-	if !strings.Contains(urlPath, "?") {
-		sb.WriteString("?")
-	} else {
-		sb.WriteString("&")
+	// first and last pages are read forward, a negative limit only applies to the previous and next pages
+	p.First = links.link("marker", "", "limit", strconv.FormatInt(absLimit(limit), 10))
+	if count.Exact {
+		p.Last = links.link("marker", "last", "limit", strconv.FormatInt(absLimit(limit), 10))
 	}
 
-	sb.WriteString("marker=%s&limit=%d")
+	if previous != nil {
+		previousMarker, err := DefaultCursorCodec.Encode(*previous)
+		if err != nil {
+			return p, err
+		}
+		p.Previous = links.link("marker", previousMarker, "limit", strconv.FormatInt(limit, 10))
+	}
 
-	firstPath := fmt.Sprintf(sb.String(), "", limit)
-	p.First = &firstPath
-	lastPath := fmt.Sprintf(sb.String(), "last", limit)
-	p.Last = &lastPath
+	if next != nil {
+		nextMarker, err := DefaultCursorCodec.Encode(*next)
+		if err != nil {
+			return p, err
+		}
+		p.Next = links.link("marker", nextMarker, "limit", strconv.FormatInt(limit, 10))
+	}
 
-	previousPath := fmt.Sprintf(sb.String(), strconv.FormatInt(previousMarker, 10), limit)
-	p.Previous = &previousPath
+	p.Total = count.Total
 
-	nextPath := fmt.Sprintf(sb.String(), strconv.FormatInt(nextMarker, 10), limit)
-	p.Next = &nextPath
+	return p, nil
+}
 
-	p.Total = total
+// linkBuilder builds navigation links keeping the parameters of the request
+type linkBuilder struct {
+	path   string
+	values url.Values
+}
 
-	return p, nil
+func newLinkBuilder(urlPath string, query url.Values) (*linkBuilder, error) {
+	b := &linkBuilder{path: urlPath, values: url.Values{}}
+	if idx := strings.Index(urlPath, "?"); idx >= 0 {
+		b.path = urlPath[:idx]
+		parsed, err := url.ParseQuery(urlPath[idx+1:])
+		if err != nil {
+			return nil, err
+		}
+		b.values = parsed
+	}
+	for key, value := range query {
+		b.values[key] = value
+	}
+	return b, nil
+}
+
+// link replaces the given key value pairs in the parameters, url.Values encodes them sorted by key so the links are canonical
+func (b *linkBuilder) link(pairs ...string) *string {
+	values := url.Values{}
+	for key, value := range b.values {
+		values[key] = value
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		values.Set(pairs[i], pairs[i+1])
+	}
+
+	l := fmt.Sprintf("%s?%s", b.path, values.Encode())
+	return &l
 }
 
 func getDefaultPaginationRequest() Pagination {
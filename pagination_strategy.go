@@ -0,0 +1,196 @@
+package poctools
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// PaginationStrategy reads the pagination of the request, pages the query and builds the navigation data
+type PaginationStrategy interface {
+	// Parse reads the pagination parameters of the request
+	Parse(query url.Values) (Pagination, error)
+	// Paginate appends the order and the page selection to the query, returning their arguments.
+	// Without an exact count one more line must be read after the page, it is removed from the result
+	Paginate(query string, p ApiParams) (string, []interface{}, error)
+	// Reversed tells if the lines were read in the reversed sort order and must be reversed back
+	Reversed(p ApiParams) bool
+	// Navigate builds the navigation data around the read lines
+	Navigate(p ApiParams, count PageCount, list interface{}) (PaginationNavigationData, error)
+}
+
+// PageCount tells how many lines match the query. Without an exact count, it also tells if more lines were found
+type PageCount struct {
+	// Total is 0 with the CountNone mode, an estimate with the CountEstimated mode (0 without one) or the count limit when it is reached
+	Total int64
+	Exact bool
+	// More tells that lines were found after the page, or before it when the page was read in the reversed order
+	More bool
+}
+
+// paginationStrategy returns the strategy of the params: its own, the keyset one with Option.Keyset or the DefaultPaginationStrategy.
+// A pointer to a strategy of the package is returned as its value, so they are all recognized by their type
+func paginationStrategy(p ApiParams) PaginationStrategy {
+	if p.Strategy != nil {
+		return strategyValue(p.Strategy)
+	}
+	if p.Options[Option.Keyset] {
+		return KeysetPagination{}
+	}
+	return strategyValue(DefaultPaginationStrategy)
+}
+
+// strategyValue dereferences the pointers to the strategies of the package, they have no state so a nil one is their zero value
+func strategyValue(s PaginationStrategy) PaginationStrategy {
+	switch s.(type) {
+	case *OffsetPagination:
+		return OffsetPagination{}
+	case *KeysetPagination:
+		return KeysetPagination{}
+	case *PageNumberPagination:
+		return PageNumberPagination{}
+	}
+	return s
+}
+
+// UseStrategy switches the pagination strategy, reading again the pagination parameters of the request
+func (p *ApiParams) UseStrategy(s PaginationStrategy) error {
+	pagination, err := s.Parse(p.RequestedQuery)
+	if err != nil {
+		return err
+	}
+
+	p.Strategy = s
+	p.Pagination = pagination
+	return nil
+}
+
+// OffsetPagination skips the number of lines carried by the marker. Ex: ?marker=xxx&limit=20
+type OffsetPagination struct{}
+
+func (OffsetPagination) Parse(query url.Values) (Pagination, error) {
+	return parseMarkerPagination(query)
+}
+
+func (OffsetPagination) Paginate(query string, p ApiParams) (string, []interface{}, error) {
+	return getOffsetPaginatedQuery(query, p)
+}
+
+func (OffsetPagination) Reversed(p ApiParams) bool {
+	return p.Pagination.Marker == "last" || (p.Pagination.Limit < 0 && len(p.Pagination.Marker) == 0)
+}
+
+func (o OffsetPagination) Navigate(p ApiParams, count PageCount, list interface{}) (PaginationNavigationData, error) {
+	var previous, next *CursorState
+	hasMore := false
+	switch {
+	case !count.Exact:
+		previous, next = computeUncountedNextAndPrevious(p.Pagination, o.Reversed(p), count.More)
+		hasMore = next != nil
+	case p.Pagination.Limit < 0:
+		next, previous = computeBackwardNextAndPrevious(p.Pagination, count.Total)
+		hasMore = next != nil
+	default:
+		nextOffset, previousOffset := computeNextAndPrevious(p.Pagination, count.Total)
+		previous, next = &CursorState{Offset: previousOffset}, &CursorState{Offset: nextOffset}
+		hasMore = nextOffset < count.Total && p.Pagination.Marker != "last"
+	}
+
+	pnd, err := getPaginationNavigationData(p.BaseURL+p.RequestedURLPath, p.RequestedQuery, previous, next, count, p.Pagination.Limit)
+	pnd.HasMore = hasMore
+	return pnd, err
+}
+
+// KeysetPagination seeks the lines after the values of the sort fields carried by the marker. Ex: ?marker=xxx&limit=20
+type KeysetPagination struct{}
+
+func (KeysetPagination) Parse(query url.Values) (Pagination, error) {
+	return parseMarkerPagination(query)
+}
+
+func (KeysetPagination) Paginate(query string, p ApiParams) (string, []interface{}, error) {
+	return getKeysetPaginatedQuery(query, p)
+}
+
+func (KeysetPagination) Reversed(p ApiParams) bool {
+	return isBackwardPage(p)
+}
+
+func (KeysetPagination) Navigate(p ApiParams, count PageCount, list interface{}) (PaginationNavigationData, error) {
+	previous, next, err := getKeysetCursors(p, count, list)
+	if err != nil {
+		return PaginationNavigationData{}, fmt.Errorf("unable to create the cursors: %w", err)
+	}
+
+	pnd, err := getPaginationNavigationData(p.BaseURL+p.RequestedURLPath, p.RequestedQuery, previous, next, count, p.Pagination.Limit)
+	pnd.HasMore = next != nil
+	return pnd, err
+}
+
+// PageNumberPagination reads numbered pages, starting from 1. Ex: ?page=3&per_page=20
+type PageNumberPagination struct{}
+
+func (PageNumberPagination) Parse(query url.Values) (Pagination, error) {
+	p := Pagination{Page: 1, Limit: DefaultPaginationLimit}
+
+	if page, err := strconv.ParseInt(query.Get("page"), 10, 64); err == nil && page > 0 {
+		p.Page = page
+	}
+	if perPage, err := strconv.ParseInt(query.Get("per_page"), 10, 64); err == nil && perPage > 0 {
+		p.Limit = perPage
+	}
+	return p, nil
+}
+
+func (PageNumberPagination) Paginate(query string, p ApiParams) (string, []interface{}, error) {
+	return pageSQL(query, p, pageNumberPaginate)
+}
+
+func pageNumberPaginate(q pagedQuery, p ApiParams) error {
+	page := p.Pagination.Page
+	if page < 1 {
+		page = 1
+	}
+
+	orderPage(q, p, false)
+	q.setLimit(GetDialect().LimitOffset(p.Pagination.Limit+lookahead(p), (page-1)*p.Pagination.Limit, q.ordered()))
+	return nil
+}
+
+func (PageNumberPagination) Reversed(p ApiParams) bool {
+	return false
+}
+
+func (PageNumberPagination) Navigate(p ApiParams, count PageCount, list interface{}) (PaginationNavigationData, error) {
+	pnd := PaginationNavigationData{Total: count.Total, Page: p.Pagination.Page, PerPage: p.Pagination.Limit, TotalExact: count.Exact}
+	if pnd.Page < 1 {
+		pnd.Page = 1
+	}
+	if pnd.PerPage < 1 {
+		return pnd, fmt.Errorf("invalid page size %d", pnd.PerPage)
+	}
+	if count.Exact {
+		pnd.TotalPages = (count.Total + pnd.PerPage - 1) / pnd.PerPage
+	}
+	pnd.HasMore = pnd.Page < pnd.TotalPages || count.More
+
+	links, err := newLinkBuilder(p.BaseURL+p.RequestedURLPath, p.RequestedQuery)
+	if err != nil {
+		return pnd, err
+	}
+	pageLink := func(page int64) *string {
+		return links.link("page", strconv.FormatInt(page, 10), "per_page", strconv.FormatInt(pnd.PerPage, 10))
+	}
+
+	pnd.First = pageLink(1)
+	if count.Exact {
+		pnd.Last = pageLink(pnd.TotalPages)
+	}
+	if pnd.Page > 1 {
+		pnd.Previous = pageLink(pnd.Page - 1)
+	}
+	if pnd.HasMore {
+		pnd.Next = pageLink(pnd.Page + 1)
+	}
+	return pnd, nil
+}
@@ -0,0 +1,54 @@
+package poctools
+
+import (
+	"testing"
+)
+
+func TestPaginationStrategyPointers(t *testing.T) {
+	cursor := &CursorState{Values: []interface{}{int64(10)}}
+
+	tests := []struct {
+		name     string
+		strategy PaginationStrategy
+		want     PaginationStrategy
+		query    string
+	}{
+		{"offset", OffsetPagination{}, OffsetPagination{}, "select id from t order by `id` limit ?"},
+		{"offset pointer", &OffsetPagination{}, OffsetPagination{}, "select id from t order by `id` limit ?"},
+		{"keyset", KeysetPagination{}, KeysetPagination{}, "select id from t where ((`id`) > (?)) order by `id` limit ?"},
+		{"keyset pointer", &KeysetPagination{}, KeysetPagination{}, "select id from t where ((`id`) > (?)) order by `id` limit ?"},
+		{"page number pointer", &PageNumberPagination{}, PageNumberPagination{}, "select id from t order by `id` limit ?"},
+		{"nil keyset pointer", (*KeysetPagination)(nil), KeysetPagination{}, "select id from t where ((`id`) > (?)) order by `id` limit ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ApiParams{
+				Strategy:   tt.strategy,
+				CountMode:  CountWindow,
+				Pagination: Pagination{Limit: 10, Page: 1},
+			}
+			if _, keyset := tt.want.(KeysetPagination); keyset {
+				p.Pagination.Marker, p.Pagination.Cursor = "cursor", cursor
+			}
+
+			if got := paginationStrategy(p); got != tt.want {
+				t.Errorf("got the strategy %#v, want %#v", got, tt.want)
+			}
+
+			q, err := paginateQuery(&sqlQuery{sql: "select id from t"}, p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if query, _ := q.Build(); query != tt.query {
+				t.Errorf("got %q, want %q", query, tt.query)
+			}
+
+			// the total of a keyset page is never read with a window, the seek condition would be counted
+			_, keyset := tt.want.(KeysetPagination)
+			if windowed(p, &[]pagedLine{}, &sqlQuery{sql: "select id from t"}) == keyset {
+				t.Errorf("windowed: got %v for a keyset strategy %v", !keyset, keyset)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package poctools
+
+import (
+	"errors"
+	"testing"
+)
+
+type pagedLine struct {
+	Id   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestPaginatorKeepsCursorErrors(t *testing.T) {
+	// the cursor was built for a single sort field, the request now sorts by two
+	params := ApiParams{
+		RequestedURLPath: "/lines",
+		Strategy:         KeysetPagination{},
+		Orders:           []Order{{Name: "name", OrderField: "name"}},
+		Pagination:       Pagination{Limit: 10, Marker: "cursor", Cursor: &CursorState{Values: []interface{}{int64(3)}}},
+	}
+	s := CreateSqlExecutorWithCountCache(nil, nil)
+
+	_, err := PaginatorFor(pagedLine{}).WithSqlExecutor(s).WithQuery("select id, name from lines").WithParams(params).Do()
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Do: got %v, want an ErrInvalidCursor", err)
+	}
+
+	identity := func(lines []pagedLine) []pagedLine { return lines }
+	_, err = FindAllPagedMapped(s, "select id, name from lines", params, identity)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("FindAllPagedMapped: got %v, want an ErrInvalidCursor", err)
+	}
+}
+
+// pagedSession reads the lines up to the limit, the last argument of the page query, and counts the total
+type pagedSession struct {
+	lines []pagedLine
+	total int64
+}
+
+func (s *pagedSession) ReadOne(query string, entity interface{}, pars ...interface{}) error {
+	return nil
+}
+
+func (s *pagedSession) ReadMany(query string, entity interface{}, pars ...interface{}) error {
+	switch e := entity.(type) {
+	case *[]pagedLine:
+		lines := s.lines
+		if limit, ok := pars[len(pars)-1].(int64); ok && int64(len(lines)) > limit {
+			lines = lines[:limit]
+		}
+		*e = append(*e, lines...)
+	case *[]int64:
+		*e = append(*e, s.total)
+	}
+	return nil
+}
+
+func (s *pagedSession) Write(query string, entity interface{}) (uint64, error) {
+	return 0, nil
+}
+
+func (s *pagedSession) Close(aborted bool) error {
+	return nil
+}
+
+func (s *pagedSession) SetAutoCommit(auto bool) {}
+
+func pagedLines(from, to int64) []pagedLine {
+	var lines []pagedLine
+	for id := from; id <= to; id++ {
+		lines = append(lines, pagedLine{Id: id})
+	}
+	return lines
+}
+
+func TestKeysetPageFollowedByLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []pagedLine
+		hasMore bool
+	}{
+		{"exactly full last page", pagedLines(11, 20), false},
+		{"page followed by lines", pagedLines(11, 21), true},
+		{"partial last page", pagedLines(11, 15), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := ApiParams{
+				RequestedURLPath: "/lines",
+				Strategy:         KeysetPagination{},
+				CountMode:        CountExact,
+				Pagination:       Pagination{Limit: 10, Marker: "cursor", Cursor: &CursorState{Values: []interface{}{int64(10)}}},
+			}
+			s := CreateSqlExecutorWithCountCache(&pagedSession{lines: tt.lines, total: 20}, nil)
+
+			r, err := PaginatorFor(pagedLine{}).WithSqlExecutor(s).WithQuery("select id, name from lines").WithParams(params).Do()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if r.Pagination.HasMore != tt.hasMore || (r.Pagination.Next != nil) != tt.hasMore {
+				t.Errorf("got has more %v and next %v, want %v", r.Pagination.HasMore, r.Pagination.Next, tt.hasMore)
+			}
+			if len(*r.Data) > 10 {
+				t.Errorf("got %d lines, want at most 10", len(*r.Data))
+			}
+		})
+	}
+}
+
+// markerPagination is a page of the offset pagination, the marker is empty, last or the offset of the cursor
+func markerPagination(limit int64, marker interface{}) Pagination {
+	switch m := marker.(type) {
+	case int64:
+		return Pagination{Limit: limit, Marker: "cursor", Cursor: &CursorState{Offset: m}}
+	case string:
+		return Pagination{Limit: limit, Marker: m}
+	}
+	return Pagination{Limit: limit}
+}
+
+// cursorOffset is the offset of the cursor, -1 when there is no such page
+func cursorOffset(c *CursorState) int64 {
+	if c == nil {
+		return -1
+	}
+	return c.Offset
+}
+
+func TestComputeBackwardNextAndPrevious(t *testing.T) {
+	tests := []struct {
+		name     string
+		marker   interface{}
+		previous int64
+		next     int64
+	}{
+		{"no marker", "", 15, -1},
+		{"last", "last", 15, -1},
+		{"middle", int64(20), 10, 30},
+		{"last full page", int64(25), 15, -1},
+		{"page cut by the end", int64(30), 20, -1},
+		{"past the end", int64(40), 30, -1},
+		{"first page", int64(10), -1, 20},
+		{"before the start", int64(5), -1, 15},
+		{"at the start", int64(0), -1, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, previous := computeBackwardNextAndPrevious(markerPagination(-10, tt.marker), 25)
+			if cursorOffset(previous) != tt.previous || cursorOffset(next) != tt.next {
+				t.Errorf("got previous %d next %d, want %d %d", cursorOffset(previous), cursorOffset(next), tt.previous, tt.next)
+			}
+		})
+	}
+}
+
+func TestComputeUncountedNextAndPrevious(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int64
+		marker   interface{}
+		reversed bool
+		more     bool
+		previous int64
+		next     int64
+	}{
+		{"first page", 10, "", false, true, -1, 10},
+		{"only page", 10, "", false, false, -1, -1},
+		{"middle", 10, int64(20), false, true, 10, 30},
+		{"last page", 10, int64(20), false, false, 10, -1},
+		{"marker before a full page", 10, int64(5), false, true, 0, 15},
+		{"reversed", 10, "last", true, true, -1, -1},
+		{"backward middle", -10, int64(20), false, true, 10, 30},
+		{"backward without more", -10, int64(20), false, false, 10, -1},
+		{"backward before the start", -10, int64(5), false, true, -1, 15},
+		{"backward at the start", -10, int64(0), false, true, -1, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous, next := computeUncountedNextAndPrevious(markerPagination(tt.limit, tt.marker), tt.reversed, tt.more)
+			if cursorOffset(previous) != tt.previous || cursorOffset(next) != tt.next {
+				t.Errorf("got previous %d next %d, want %d %d", cursorOffset(previous), cursorOffset(next), tt.previous, tt.next)
+			}
+		})
+	}
+}
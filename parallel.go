@@ -0,0 +1,89 @@
+package poctools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// parallelSession returns the session able to run the paginated queries in parallel, with the Option.Parallel and no bound transaction
+func (S *sqlExecutor) parallelSession(p ApiParams) (ContextDbSession, bool) {
+	if !p.Options[Option.Parallel] {
+		return nil, false
+	}
+
+	session, ok := S.ds.(ContextDbSession)
+	if !ok || session.InTransaction() {
+		return nil, false
+	}
+	return session, true
+}
+
+// contextSession runs the reads with the context of the request
+type contextSession struct {
+	ContextDbSession
+	ctx context.Context
+}
+
+func (s contextSession) ReadMany(query string, entity interface{}, pars ...interface{}) error {
+	return s.ReadManyContext(s.ctx, query, entity, pars...)
+}
+
+// runParallel runs the functions in parallel, joining their errors
+func runParallel(ctx context.Context, fns ...func() error) error {
+	errs := make([]error, len(fns))
+
+	var wg sync.WaitGroup
+	for i, fn := range fns {
+		wg.Add(1)
+		go func(i int, fn func() error) {
+			defer wg.Done()
+			errs[i] = fn()
+		}(i, fn)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return joinErrors(errs...)
+}
+
+// joinErrors returns the errors that are not nil, nil when there is none
+func joinErrors(errs ...error) error {
+	var joined multiError
+	for _, err := range errs {
+		if err != nil {
+			joined = append(joined, err)
+		}
+	}
+
+	switch len(joined) {
+	case 0:
+		return nil
+	case 1:
+		return joined[0]
+	}
+	return joined
+}
+
+// multiError holds the errors of the queries run in parallel, each of them is matched by errors.Is
+type multiError []error
+
+func (m multiError) Error() string {
+	messages := make([]string, len(m))
+	for i, err := range m {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (m multiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
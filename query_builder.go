@@ -0,0 +1,223 @@
+package poctools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QueryBuilder writes a select from its clauses. Given to PaginatorFor(...).WithQuery, the filters, sort criteria,
+// page selection and count are added to its clauses instead of rewriting a sql string.
+// Ex: Select("o.id", "sum(i.amount) as total").From("orders o").Join("items i", "i.order_id = o.id").GroupBy("o.id")
+type QueryBuilder struct {
+	distinct  bool
+	columns   []string
+	from      string
+	joins     []string
+	where     []Condition
+	groupBy   []string
+	having    []Condition
+	orderBy   []string
+	limit     string
+	limitArgs []interface{}
+}
+
+// Select starts a query reading the columns, no column reads them all
+func Select(columns ...string) *QueryBuilder {
+	return &QueryBuilder{columns: columns}
+}
+
+func (b *QueryBuilder) Distinct() *QueryBuilder {
+	b.distinct = true
+	return b
+}
+
+// From sets the table read by the query, with its alias. Ex: From("orders o")
+func (b *QueryBuilder) From(table string) *QueryBuilder {
+	b.from = table
+	return b
+}
+
+// Join adds an inner join of the table on the condition. Ex: Join("customers c", "c.id = o.customer_id")
+func (b *QueryBuilder) Join(table, on string) *QueryBuilder {
+	b.joins = append(b.joins, fmt.Sprintf("join %s on %s", table, on))
+	return b
+}
+
+// LeftJoin adds a left join of the table on the condition
+func (b *QueryBuilder) LeftJoin(table, on string) *QueryBuilder {
+	b.joins = append(b.joins, fmt.Sprintf("left join %s on %s", table, on))
+	return b
+}
+
+// Where adds a condition with its ? arguments, the conditions are joined with and
+func (b *QueryBuilder) Where(condition string, args ...interface{}) *QueryBuilder {
+	b.where = append(b.where, Condition{Sql: condition, Args: args})
+	return b
+}
+
+func (b *QueryBuilder) GroupBy(columns ...string) *QueryBuilder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
+// Having adds a condition on the groups with its ? arguments, the conditions are joined with and
+func (b *QueryBuilder) Having(condition string, args ...interface{}) *QueryBuilder {
+	b.having = append(b.having, Condition{Sql: condition, Args: args})
+	return b
+}
+
+// OrderBy adds sort criteria, the ones of the paginated request are placed before them
+// and the primary key after them when the request has none
+func (b *QueryBuilder) OrderBy(items ...string) *QueryBuilder {
+	b.orderBy = append(b.orderBy, items...)
+	return b
+}
+
+// Build returns the sql of the query with its arguments in the order of their placeholders
+func (b *QueryBuilder) Build() (string, []interface{}) {
+	var args []interface{}
+	parts := []string{"select"}
+	if b.distinct {
+		parts = append(parts, "distinct")
+	}
+
+	columns := b.columns
+	if len(columns) == 0 {
+		columns = []string{"*"}
+	}
+	parts = append(parts, strings.Join(columns, ", "))
+
+	if len(b.from) > 0 {
+		parts = append(parts, "from", b.from)
+	}
+	parts = append(parts, b.joins...)
+
+	if len(b.where) > 0 {
+		var where string
+		where, args = joinConditions(b.where, args)
+		parts = append(parts, "where", where)
+	}
+	if len(b.groupBy) > 0 {
+		parts = append(parts, "group by", strings.Join(b.groupBy, ", "))
+	}
+	if len(b.having) > 0 {
+		var having string
+		having, args = joinConditions(b.having, args)
+		parts = append(parts, "having", having)
+	}
+	if len(b.orderBy) > 0 {
+		parts = append(parts, "order by", strings.Join(b.orderBy, ", "))
+	}
+	if len(b.limit) > 0 {
+		parts = append(parts, b.limit)
+		args = append(args, b.limitArgs...)
+	}
+	return strings.Join(parts, " "), args
+}
+
+// String returns the sql of the query, without its arguments
+func (b *QueryBuilder) String() string {
+	query, _ := b.Build()
+	return query
+}
+
+// joinConditions joins the conditions with and, the ones with a top level or are kept in parentheses
+func joinConditions(conditions []Condition, args []interface{}) (string, []interface{}) {
+	parts := make([]string, len(conditions))
+	for i, c := range conditions {
+		parts[i] = c.Sql
+		if len(conditions) > 1 && analyzeQuery(c.Sql).hasTopLevel("or", 0, len(c.Sql)) {
+			parts[i] = fmt.Sprintf("(%s)", c.Sql)
+		}
+		args = append(args, c.Args...)
+	}
+	return strings.Join(parts, " and "), args
+}
+
+// clone copies the builder, so the page and the count add their clauses to their own copies
+func (b *QueryBuilder) clone() *QueryBuilder {
+	c := *b
+	c.columns = append([]string{}, b.columns...)
+	c.joins = append([]string{}, b.joins...)
+	c.where = append([]Condition{}, b.where...)
+	c.groupBy = append([]string{}, b.groupBy...)
+	c.having = append([]Condition{}, b.having...)
+	c.orderBy = append([]string{}, b.orderBy...)
+	c.limitArgs = append([]interface{}{}, b.limitArgs...)
+	return &c
+}
+
+func (b *QueryBuilder) copyQuery() pagedQuery {
+	return b.clone()
+}
+
+// filter adds the filters and conditions to the where clause, the aggregate ones to the having clause of a grouped query
+func (b *QueryBuilder) filter(f []Filter, conditions []Condition) {
+	whereFilters, whereConditions, havingFilters, havingConditions := splitAggregates(f, conditions, len(b.groupBy) > 0)
+
+	if len(whereFilters) > 0 || len(whereConditions) > 0 {
+		pars, condition := appendFiltersConditions(whereFilters, whereConditions, nil, "")
+		b.where = append(b.where, Condition{Sql: condition, Args: pars})
+	}
+	if len(havingFilters) > 0 || len(havingConditions) > 0 {
+		pars, condition := appendFiltersConditions(havingFilters, havingConditions, nil, "")
+		b.having = append(b.having, Condition{Sql: condition, Args: pars})
+	}
+}
+
+func (b *QueryBuilder) reverseOrderBy() {
+	for i, item := range b.orderBy {
+		b.orderBy[i] = reverseOrderItem(item)
+	}
+}
+
+func (b *QueryBuilder) addOrderBy(items string) {
+	b.orderBy = append([]string{items}, b.orderBy...)
+}
+
+func (b *QueryBuilder) appendOrderBy(items string) {
+	b.orderBy = append(b.orderBy, items)
+}
+
+func (b *QueryBuilder) ordered() bool {
+	return len(b.orderBy) > 0
+}
+
+func (b *QueryBuilder) isDistinct() bool {
+	return b.distinct
+}
+
+func (b *QueryBuilder) setLimit(clause string, args []interface{}) {
+	b.limit, b.limitArgs = clause, args
+}
+
+func (b *QueryBuilder) addColumns(columns string) {
+	if len(b.columns) == 0 {
+		b.columns = []string{"*"}
+	}
+	b.columns = append(b.columns, columns)
+}
+
+// countQuery counts the lines of the query without its sort, a grouped or distinct query is counted as a sub query
+func (b *QueryBuilder) countQuery(limit int64) (string, []interface{}) {
+	c := b.clone()
+	c.orderBy = nil
+	c.limit, c.limitArgs = "", nil
+	wrapped := c.distinct || len(c.groupBy) > 0 || len(c.having) > 0
+
+	if limit > 0 {
+		if !wrapped {
+			c.columns = []string{"1"}
+		}
+		c.setLimit(GetDialect().LimitOffset(limit+1, 0, false))
+		query, args := c.Build()
+		return fmt.Sprintf("select count(1) from (%s) as cnt", query), args
+	}
+
+	if wrapped {
+		query, args := c.Build()
+		return fmt.Sprintf("select count(1) from (%s) as cnt", query), args
+	}
+	c.columns = []string{"count(1)"}
+	return c.Build()
+}
@@ -3,61 +3,211 @@ package poctools
 import (
 	"fmt"
 	"reflect"
-	"regexp"
-	"strconv"
 	"strings"
 )
 
-const (
-	ROUND_BRACKET_PATTERN = `\([^)()]+\)`
-)
+// pagedQuery is the query being paged: a sql string rewritten through the analyzer, or a *QueryBuilder
+type pagedQuery interface {
+	Build() (string, []interface{})
+	copyQuery() pagedQuery
+	// filter adds the filters and conditions, the aggregate ones to the having clause of a grouped query
+	filter(f []Filter, conditions []Condition)
+	// reverseOrderBy flips the direction and the nulls placement of the sort criteria of the query
+	reverseOrderBy()
+	// addOrderBy sorts by the items before the sort criteria of the query
+	addOrderBy(items string)
+	// appendOrderBy sorts by the items after the sort criteria of the query
+	appendOrderBy(items string)
+	ordered() bool
+	// isDistinct tells if the main select removes the duplicate lines
+	isDistinct() bool
+	setLimit(clause string, args []interface{})
+	// addColumns adds the columns at the end of the select list
+	addColumns(columns string)
+	// countQuery counts the lines of the query, only the first limit + 1 lines when a limit is given
+	countQuery(limit int64) (string, []interface{})
+}
 
-func getPaginatedQuery(query string, p ApiParams) (result string, paginationParams []interface{}) {
+// sqlQuery is a sql string with the arguments of its placeholders
+type sqlQuery struct {
+	sql  string
+	args []interface{}
+}
 
-	ordered := false
-	marker, err := strconv.Atoi(p.Pagination.Marker)
-	if err != nil {
-		if len(p.Pagination.Marker) == 0 {
-			marker = 0
-		}
+func (q *sqlQuery) Build() (string, []interface{}) {
+	return q.sql, q.args
+}
+
+func (q *sqlQuery) copyQuery() pagedQuery {
+	return &sqlQuery{sql: q.sql, args: append([]interface{}{}, q.args...)}
+}
+
+func (q *sqlQuery) filter(f []Filter, conditions []Condition) {
+	var pars []interface{}
+	q.sql, pars = getFilteredQuery(q.sql, f, conditions...)
+	q.args = append(q.args, pars...)
+}
+
+func (q *sqlQuery) reverseOrderBy() {
+	q.sql = reverseOrderBy(q.sql)
+}
+
+func (q *sqlQuery) addOrderBy(items string) {
+	q.sql = addOrderBy(q.sql, items)
+}
+
+func (q *sqlQuery) appendOrderBy(items string) {
+	q.sql = appendOrderBy(q.sql, items)
+}
+
+func (q *sqlQuery) ordered() bool {
+	return analyzeQuery(q.sql).has(clauseOrderBy)
+}
+
+func (q *sqlQuery) isDistinct() bool {
+	return analyzeQuery(q.sql).distinct
+}
+
+// setLimit writes the clause before the locking clause of the query, ex: for update
+func (q *sqlQuery) setLimit(clause string, args []interface{}) {
+	at := analyzeQuery(q.sql).insertionPoint(clauseFor)
+	q.sql = splice(q.sql, at, at, clause)
+	q.args = append(q.args, args...)
+}
 
-		if p.Pagination.Marker == "last" {
-			_, _, _, hasDesc := testClauses(query)
+func (q *sqlQuery) addColumns(columns string) {
+	q.sql = addSelectColumns(q.sql, columns)
+}
 
-			if hasDesc {
-				tokens := queryTokens(query)
-				tokens = tokens[:len(tokens)-1] // remove last token tha must be desc
-				query = strings.Join(tokens, " ")
+func (q *sqlQuery) countQuery(limit int64) (string, []interface{}) {
+	countQuery, limitPars := getCountQuery(q.sql, limit)
+	return countQuery, append(append([]interface{}{}, q.args...), limitPars...)
+}
 
-			} else {
+// paginateQuery pages the query with the strategy of the params. The strategies of the package page it in place,
+// a *QueryBuilder through its clauses. The other ones page its sql, their arguments following the ones of the query
+func paginateQuery(q pagedQuery, p ApiParams) (pagedQuery, error) {
+	strategy := paginationStrategy(p)
+	switch strategy.(type) {
+	case OffsetPagination:
+		return q, offsetPaginate(q, p)
+	case KeysetPagination:
+		return q, keysetPaginate(q, p)
+	case PageNumberPagination:
+		return q, pageNumberPaginate(q, p)
+	}
 
-				if p.Order != nil {
-					query = fmt.Sprintf("%s order by %s desc", query, p.Order.OrderField)
-				} else {
-					query = fmt.Sprintf("%s order by id desc", query)
-				}
+	query, args := q.Build()
+	paged, pars, err := strategy.Paginate(query, p)
+	return &sqlQuery{sql: paged, args: append(append([]interface{}{}, args...), pars...)}, err
+}
 
-				ordered = true
-			}
+// pageSQL pages a sql string with a strategy of the package, returning only the arguments it added
+func pageSQL(query string, p ApiParams, paginate func(pagedQuery, ApiParams) error) (string, []interface{}, error) {
+	q := &sqlQuery{sql: query}
+	if err := paginate(q, p); err != nil {
+		return "", nil, err
+	}
+	return q.sql, q.args, nil
+}
+
+func getOffsetPaginatedQuery(query string, p ApiParams) (result string, paginationParams []interface{}, err error) {
+	return pageSQL(query, p, offsetPaginate)
+}
 
-			marker = 0
+func offsetPaginate(q pagedQuery, p ApiParams) error {
+
+	reversed := false
+	cursor, err := p.Pagination.cursor()
+	if err != nil {
+		return err
+	}
+	marker := cursor.Offset
+	limit := p.Pagination.Limit
+	extra := lookahead(p)
+
+	if (OffsetPagination{}).Reversed(p) {
+		// the last lines are read in the reversed order of every sort criterion, the ones of the query included
+		reversed = true
+		q.reverseOrderBy()
+		limit = absLimit(limit)
+
+	} else if limit < 0 {
+		// backward from a marker: the lines just before it, read in the natural order
+		limit = -limit
+		if limit > marker {
+			limit = marker
 		}
+		marker -= limit
+	}
 
+	orderPage(q, p, reversed)
+	q.setLimit(GetDialect().LimitOffset(limit+extra, marker, q.ordered()))
+	return nil
+}
+
+// orderPage sorts the page by the requested orders followed by the primary key, before the sort criteria of the query.
+// Without requested orders the primary key follows the sort criteria of the query. The key is a tie breaker,
+// so the pages neither overlap nor skip lines and the reversed pages mirror the forward ones
+func orderPage(q pagedQuery, p ApiParams, reversed bool) {
+	if len(p.Orders) > 0 {
+		q.addOrderBy(orderByClause(keysetOrders(p), reversed))
+		return
 	}
+	q.appendOrderBy(orderByClause([]Order{{OrderField: keyField(p)}}, reversed))
+}
 
-	paginationParams = append(paginationParams, p.Pagination.Limit, marker)
+// lookahead is the number of lines read after the page, one without an exact count to know if there are more lines.
+// The keyset pages always read it, the total does not tell if lines follow the cursor
+func lookahead(p ApiParams) int64 {
+	if _, keyset := paginationStrategy(p).(KeysetPagination); keyset {
+		return 1
+	}
 
-	if !ordered && p.Order != nil {
-		if p.Order.Desc {
-			query = fmt.Sprintf("%s order by %s desc", query, p.Order.OrderField)
-		} else {
-			query = fmt.Sprintf("%s order by %s", query, p.Order.OrderField)
+	switch countMode(p) {
+	case CountExact:
+		if countLimit(p) > 0 {
+			return 1
 		}
+	case CountNone, CountEstimated:
+		return 1
 	}
+	return 0
+}
 
-	query = fmt.Sprintf("%s limit ? offset ?", query)
-	query = strings.Trim(query, " ")
-	return query, paginationParams
+// pageSize returns the number of lines of the page, a page read backward from an offset marker stops at the first line
+func pageSize(p ApiParams) int64 {
+	size := absLimit(p.Pagination.Limit)
+
+	offset, ok := paginationStrategy(p).(OffsetPagination)
+	if ok && p.Pagination.Limit < 0 && !offset.Reversed(p) {
+		if cursor, err := p.Pagination.cursor(); err == nil && cursor.Offset < size {
+			size = cursor.Offset
+		}
+	}
+	return size
+}
+
+func absLimit(limit int64) int64 {
+	if limit < 0 {
+		return -limit
+	}
+	return limit
+}
+
+// orderByClause joins the sort criteria, reversed flips every direction and nulls placement
+func orderByClause(orders []Order, reversed bool) string {
+	items := make([]string, len(orders))
+	for i, o := range orders {
+		nulls := o.Nulls
+		if reversed && nulls == NullsFirst {
+			nulls = NullsLast
+		} else if reversed && nulls == NullsLast {
+			nulls = NullsFirst
+		}
+		items[i] = GetDialect().OrderItem(o.field(), o.Desc != reversed, nulls)
+	}
+	return strings.Join(items, ", ")
 }
 
 func (*sqlExecutor) reverseResult(entity interface{}) {
@@ -74,122 +224,109 @@ func (*sqlExecutor) reverseResult(entity interface{}) {
 	}
 }
 
-func getFilteredQuery(query string, f []Filter) (result string, pars []interface{}) {
+// trimResult removes the lines beyond the limit, telling if there were some
+func (*sqlExecutor) trimResult(entity interface{}, limit int64) bool {
+	srcArr := reflect.Indirect(reflect.ValueOf(entity))
+	if int64(srcArr.Len()) <= limit {
+		return false
+	}
 
-	if len(f) == 0 {
+	srcArr.Set(srcArr.Slice(0, int(limit)))
+	return true
+}
+
+func getFilteredQuery(query string, f []Filter, conditions ...Condition) (result string, pars []interface{}) {
+
+	if len(f) == 0 && len(conditions) == 0 {
 		return query, pars
 	}
 
-	hasWhere, hasGroupBy, _, _ := testClauses(query)
-	if !hasWhere {
-		if hasGroupBy {
-			var filterConditions string
-			pars, filterConditions = appendFiltersConditions(f, pars, "")
-			replaceFor := fmt.Sprintf(" where %s group by ", filterConditions)
-			query = replaceInMainQuery(query, " group by ", replaceFor)
+	// the aggregate filters go to the having clause of a grouped query, the where clause is before it
+	whereFilters, whereConditions, havingFilters, havingConditions := splitAggregates(f, conditions, analyzeQuery(query).has(clauseGroupBy))
+
+	var filterConditions string
+	if len(whereFilters) > 0 || len(whereConditions) > 0 {
+		pars, filterConditions = appendFiltersConditions(whereFilters, whereConditions, pars, "")
+		query = addWhereConditions(query, filterConditions)
+	}
+	if len(havingFilters) > 0 || len(havingConditions) > 0 {
+		pars, filterConditions = appendFiltersConditions(havingFilters, havingConditions, pars, "")
+		query = addHavingConditions(query, filterConditions)
+	}
+	return query, pars
+}
 
+// splitAggregates separates the filters and conditions of the where clause from the aggregate ones of a grouped query
+func splitAggregates(f []Filter, conditions []Condition, grouped bool) (whereFilters []Filter, whereConditions []Condition, havingFilters []Filter, havingConditions []Condition) {
+	for _, filter := range f {
+		if grouped && filter.Aggregate {
+			havingFilters = append(havingFilters, filter)
 		} else {
-			query = fmt.Sprintf("%s where ", query)
-			pars, query = appendFiltersConditions(f, pars, query)
+			whereFilters = append(whereFilters, filter)
 		}
-	} else {
-		if hasGroupBy {
-			var filterConditions string
-			pars, filterConditions = appendFiltersConditions(f, pars, "")
-			replaceFor := fmt.Sprintf(" %s and ", filterConditions)
-			query = replaceInMainQuery(query, " where ", replaceFor)
-
+	}
+	for _, c := range conditions {
+		if grouped && c.Aggregate {
+			havingConditions = append(havingConditions, c)
 		} else {
-			query = fmt.Sprintf("%s and ", query)
-			pars, query = appendFiltersConditions(f, pars, query)
+			whereConditions = append(whereConditions, c)
 		}
 	}
-	query = strings.Trim(query, " ")
-	return query, pars
+	return whereFilters, whereConditions, havingFilters, havingConditions
 }
 
-func appendFiltersConditions(f []Filter, pars []interface{}, query string) ([]interface{}, string) {
+func appendFiltersConditions(f []Filter, extra []Condition, pars []interface{}, query string) ([]interface{}, string) {
+	conditions := make([]string, 0, len(f)+len(extra))
 	for _, filter := range f {
-		pars = append(pars, filter.Value)
-		query = fmt.Sprintf("%s%s=? ", query, filter.WhereField)
+		var condition string
+		condition, pars = filterCondition(filter, pars)
+		conditions = append(conditions, condition)
+	}
+	for _, c := range extra {
+		conditions = append(conditions, fmt.Sprintf("(%s)", c.Sql))
+		pars = append(pars, c.Args...)
 	}
+	query = fmt.Sprintf("%s%s", query, strings.Join(conditions, " and "))
 	query = strings.Trim(query, " ")
 	return pars, query
 }
 
-// testClauses compute if the given query has where and order by clause
-func testClauses(query string) (hasWhere, hasGroupBy, hasOrderBy, hasDesc bool) {
-	query = removeAllSubQueries(query)
-	query = removeQueryLinters(query)
-	hasWhere = strings.Index(query, " where ") > 0
-	hasGroupBy = strings.Index(query, " group by ") > 0
-	hasOrderBy = strings.Index(query, " order by ") > 0
-
-	tokens := queryTokens(query)
-	lastToken := tokens[len(tokens)-1]
-	hasDesc = lastToken == "desc"
-
-	return hasWhere, hasGroupBy, hasOrderBy, hasDesc
-}
-
-func queryTokens(query string) []string {
-	return strings.Split(query, " ")
-}
-
-// removeAllSubQueries only round brackets from the given query as it is a pattern of sub query
-func removeAllSubQueries(query string) string {
-	sampleRegexp := regexp.MustCompile(ROUND_BRACKET_PATTERN)
-	result := sampleRegexp.FindString(query)
-
-	for len(result) > 0 {
-		query = strings.Replace(query, result, "SQ", 1)
-		result = sampleRegexp.FindString(query)
-	}
-
-	return query
-}
-
-// replaceInMainQuery replaces some pattern from the main query
-//                    the main query is the given minus all supposed sub queries
-func replaceInMainQuery(query, replace, newValue string) string {
-	regex := regexp.MustCompile(ROUND_BRACKET_PATTERN)
-	result := regex.FindString(query)
-	var subs []string
-	idx := 0
-
-	for len(result) > 0 {
-		subs = append(subs, result)
-		subQueryLabel := fmt.Sprintf("_sq_%d_", idx)
-		idx++
-		query = strings.Replace(query, result, subQueryLabel, 1)
-		result = regex.FindString(query)
+// filterCondition returns the parameterized condition of a filter according to its operator
+func filterCondition(filter Filter, pars []interface{}) (string, []interface{}) {
+	values := filter.boundValues()
+
+	switch filter.Operator {
+	case OperatorBetween:
+		return fmt.Sprintf("%s between ? and ?", filter.field()), append(pars, values[0], values[1])
+	case OperatorLike:
+		return fmt.Sprintf("%s like ? escape '!'", filter.field()), append(pars, "%"+escapeLike(filter.Value)+"%")
+	case OperatorIn:
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			placeholders[i] = "?"
+			pars = append(pars, v)
+		}
+		return fmt.Sprintf("%s in (%s)", filter.field(), strings.Join(placeholders, ", ")), pars
 	}
 
-	query = removeQueryLinters(query)
-	replace = strings.ToLower(replace)
-	newValue = strings.ToLower(newValue)
-
-	regex = regexp.MustCompile(replace)
-	query = regex.ReplaceAllString(query, newValue)
-
-	for idx := range subs {
-		k := len(subs) - 1 - idx // now k starts from the end
-		sub := subs[k]
-		subQueryLabel := fmt.Sprintf("_sq_%d_", k)
-
-		query = strings.Replace(query, subQueryLabel, sub, 1)
+	operator, found := sqlOperators[filter.Operator]
+	if !found {
+		operator = "="
 	}
-
-	return query
+	return fmt.Sprintf("%s%s?", filter.field(), operator), append(pars, values[0])
 }
 
-// removeQueryLinters just lower and remove query linters
-func removeQueryLinters(query string) string {
-	query = strings.ToLower(query)
-	regex := regexp.MustCompile(`[\n\t]+`)
-	query = regex.ReplaceAllString(query, " ")
+var sqlOperators = map[string]string{
+	OperatorEq:  "=",
+	OperatorNe:  "<>",
+	OperatorGt:  ">",
+	OperatorGte: ">=",
+	OperatorLt:  "<",
+	OperatorLte: "<=",
+}
 
-	regex = regexp.MustCompile(`[ ]+`)
-	query = regex.ReplaceAllString(query, " ")
-	return query
+// escapeLike escapes the like wildcards of the given value using '!' as escape character
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "[", "![")
+	return replacer.Replace(value)
 }
@@ -0,0 +1,56 @@
+package poctools
+
+import (
+	"testing"
+)
+
+func TestOrderPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		orders   []Order
+		reversed bool
+		want     string
+	}{
+		{
+			name:  "primary key after the sort of the query",
+			query: "select * from t order by a",
+			want:  "select * from t order by a, `id`",
+		},
+		{
+			name:   "primary key after the requested orders",
+			query:  "select * from t",
+			orders: []Order{{OrderField: "name"}},
+			want:   "select * from t order by `name`, `id`",
+		},
+		{
+			name:   "primary key in the direction of the last order",
+			query:  "select * from t order by a",
+			orders: []Order{{OrderField: "name", Desc: true}},
+			want:   "select * from t order by `name` desc, `id` desc, a",
+		},
+		{
+			name:   "primary key already requested",
+			query:  "select * from t",
+			orders: []Order{{OrderField: "name"}, {OrderField: "id", Desc: true}},
+			want:   "select * from t order by `name`, `id` desc",
+		},
+		{
+			name:     "reversed",
+			query:    "select * from t",
+			orders:   []Order{{OrderField: "name"}},
+			reversed: true,
+			want:     "select * from t order by `name` desc, `id` desc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &sqlQuery{sql: tt.query}
+			orderPage(q, ApiParams{Orders: tt.orders}, tt.reversed)
+			if q.sql != tt.want {
+				t.Errorf("got %q, want %q", q.sql, tt.want)
+			}
+		})
+	}
+}
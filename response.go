@@ -0,0 +1,71 @@
+package poctools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaginationOutput defines where the pagination data is written in the response
+type PaginationOutput int
+
+const (
+	// PaginationOutputEnvelope writes the data and the pagination in the json body
+	PaginationOutputEnvelope PaginationOutput = iota
+	// PaginationOutputHeaders writes only the data in the json body, the pagination goes in the Link and X-Total-Count headers
+	PaginationOutputHeaders
+	// PaginationOutputBoth writes the json envelope and the headers
+	PaginationOutputBoth
+)
+
+// RespondPaginated writes the paginated response according to the DefaultPaginationOutput
+func RespondPaginated[T any](c *gin.Context, status int, r *PaginationResponse[T]) {
+	switch DefaultPaginationOutput {
+	case PaginationOutputHeaders:
+		WritePaginationHeaders(c, r)
+		data, err := r.jsonData()
+		if err != nil {
+			_ = c.AbortWithError(500, err)
+			return
+		}
+		c.JSON(status, data)
+	case PaginationOutputBoth:
+		WritePaginationHeaders(c, r)
+		c.JSON(status, r)
+	default:
+		c.JSON(status, r)
+	}
+}
+
+// WritePaginationHeaders writes the RFC 8288 Link header with the first, prev, next and last pages and the X-Total-Count header.
+// The X-Total-Count header is left out when the total is not exact
+func WritePaginationHeaders[T any](c *gin.Context, r *PaginationResponse[T]) {
+	if link := linkHeader(r.Pagination); len(link) > 0 {
+		c.Header("Link", link)
+	}
+	if r.Pagination.TotalExact {
+		c.Header("X-Total-Count", strconv.FormatInt(r.Pagination.Total, 10))
+	}
+}
+
+func linkHeader(p PaginationNavigationData) string {
+	relations := []struct {
+		rel  string
+		link *string
+	}{
+		{"first", p.First},
+		{"prev", p.Previous},
+		{"next", p.Next},
+		{"last", p.Last},
+	}
+
+	links := make([]string, 0, len(relations))
+	for _, r := range relations {
+		if r.link != nil {
+			links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, *r.link, r.rel))
+		}
+	}
+	return strings.Join(links, ", ")
+}
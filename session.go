@@ -1,6 +1,8 @@
 package poctools
 
 import (
+	"context"
+
 	"github.com/jmoiron/sqlx"
 )
 
@@ -12,6 +14,19 @@ type DbSession interface {
 	SetAutoCommit(auto bool)
 }
 
+// ContextDbSession is a session able to cancel its reads and telling if a transaction is bound to it.
+// Only those sessions run the paginated queries in parallel
+type ContextDbSession interface {
+	DbSession
+	ReadManyContext(ctx context.Context, query string, entity interface{}, pars ...interface{}) error
+	InTransaction() bool
+}
+
+// transactionListener is a session calling back when its transaction ends, committed or rolled back
+type transactionListener interface {
+	afterTransaction(fn func())
+}
+
 var dbSessionMock DbSession
 
 func MockDbSession(m DbSession) {
@@ -29,9 +44,12 @@ func DbSessionCreate(autoCommit bool) DbSession {
 type dbSessionImpl struct {
 	tx         *sqlx.Tx
 	autoCommit bool
+	// afterTx are called when the transaction ends
+	afterTx []func()
 }
 
 func (S *dbSessionImpl) ReadOne(query string, entity interface{}, pars ...interface{}) error {
+	query = GetDialect().Rebind(query)
 	if S.tx != nil {
 		return S.tx.QueryRowx(query, pars...).StructScan(entity)
 	}
@@ -39,6 +57,7 @@ func (S *dbSessionImpl) ReadOne(query string, entity interface{}, pars ...interf
 }
 
 func (S *dbSessionImpl) ReadMany(query string, entity interface{}, pars ...interface{}) error {
+	query = GetDialect().Rebind(query)
 	if S.tx != nil {
 		return S.tx.Select(entity, query, pars...)
 	}
@@ -46,6 +65,19 @@ func (S *dbSessionImpl) ReadMany(query string, entity interface{}, pars ...inter
 	return GetDbEngine().Select(entity, query, pars...)
 }
 
+func (S *dbSessionImpl) ReadManyContext(ctx context.Context, query string, entity interface{}, pars ...interface{}) error {
+	query = GetDialect().Rebind(query)
+	if S.tx != nil {
+		return S.tx.SelectContext(ctx, entity, query, pars...)
+	}
+
+	return GetDbEngine().SelectContext(ctx, entity, query, pars...)
+}
+
+func (S *dbSessionImpl) InTransaction() bool {
+	return S.tx != nil
+}
+
 func (S *dbSessionImpl) Write(sql string, entity interface{}) (uint64, error) {
 	var err error
 
@@ -56,27 +88,63 @@ func (S *dbSessionImpl) Write(sql string, entity interface{}) (uint64, error) {
 		}
 	}
 
-	result, err := S.tx.NamedExec(sql, entity)
+	var id int64
+	if !GetDialect().UsesLastInsertId() && isInsert(sql) {
+		// the id comes from the returning clause of the insert
+		id, err = S.insertReturning(sql, entity)
+	} else {
+		result, execErr := S.tx.NamedExec(sql, entity)
+		if execErr != nil {
+			return 0, execErr
+		}
+		if GetDialect().UsesLastInsertId() {
+			id, err = result.LastInsertId()
+		}
+	}
 	if err != nil {
 		return 0, err
 	}
 
-	id, err := result.LastInsertId()
 	if S.autoCommit {
 		err = S.commit()
 		if err != nil {
 			err = S.rollback()
 		}
 		S.tx = nil
+		S.endTransaction()
 	}
 
 	return uint64(id), err
 }
 
+// insertReturning runs an insert reading the id given back by its returning clause, 0 without such clause
+func (S *dbSessionImpl) insertReturning(query string, entity interface{}) (int64, error) {
+	rows, err := S.tx.NamedQuery(query, entity)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var id int64
+	if rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			return 0, err
+		}
+	}
+	return id, rows.Err()
+}
+
+func isInsert(query string) bool {
+	tokens := lexSQL(query)
+	first := nextSignificant(tokens, -1)
+	return first >= 0 && tokens[first].is("insert")
+}
+
 func (S *dbSessionImpl) Close(aborted bool) error {
 	if S.tx == nil {
 		return nil
 	}
+	defer S.endTransaction()
 
 	if aborted {
 		return S.rollback()
@@ -85,6 +153,21 @@ func (S *dbSessionImpl) Close(aborted bool) error {
 	return S.commit()
 }
 
+// afterTransaction calls fn when the transaction ends, nothing is waiting without a transaction
+func (S *dbSessionImpl) afterTransaction(fn func()) {
+	if S.tx != nil {
+		S.afterTx = append(S.afterTx, fn)
+	}
+}
+
+// endTransaction calls the functions waiting for the end of the transaction
+func (S *dbSessionImpl) endTransaction() {
+	for _, fn := range S.afterTx {
+		fn()
+	}
+	S.afterTx = nil
+}
+
 func (S *dbSessionImpl) SetAutoCommit(auto bool) {
 	S.autoCommit = auto
 }
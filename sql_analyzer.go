@@ -0,0 +1,362 @@
+package poctools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// top level clauses found by the analyzer
+const (
+	clauseSelect  = "select"
+	clauseFrom    = "from"
+	clauseWhere   = "where"
+	clauseGroupBy = "group by"
+	clauseHaving  = "having"
+	clauseWindow  = "window"
+	clauseOrderBy = "order by"
+	clauseLimit   = "limit"
+	clauseOffset  = "offset"
+	clauseFetch   = "fetch"
+	clauseFor     = "for"
+)
+
+// clausesAfterFrom are the clauses that may follow the from clause, in their order
+var clausesAfterFrom = []string{clauseWhere, clauseGroupBy, clauseHaving, clauseWindow, clauseOrderBy, clauseLimit, clauseOffset, clauseFetch, clauseFor}
+
+// sqlClause is a top level clause: start is the offset of its keyword, body the offset after it
+type sqlClause struct {
+	start int
+	body  int
+}
+
+// queryAnalysis tells where the top level clauses of the main select are, the sub queries and quoted texts are skipped
+type queryAnalysis struct {
+	query   string
+	tokens  []sqlToken
+	clauses map[string]sqlClause
+	// with tells that the query starts with common table expressions
+	with bool
+	// union tells that the query combines selects with union, intersect or except
+	union    bool
+	distinct bool
+}
+
+func analyzeQuery(query string) queryAnalysis {
+	a := queryAnalysis{query: query, tokens: lexSQL(query), clauses: map[string]sqlClause{}}
+
+	first := true
+	for i, t := range a.tokens {
+		if !t.significant() || t.depth > 0 {
+			continue
+		}
+		if first && t.is("with") {
+			a.with = true
+		}
+		first = false
+
+		if t.kind != tokenWord {
+			continue
+		}
+
+		keyword := strings.ToLower(t.text)
+		bodyToken := i
+		switch keyword {
+		case "group", "order":
+			next := nextSignificant(a.tokens, i)
+			if next < 0 || !a.tokens[next].is("by") {
+				continue
+			}
+			keyword, bodyToken = keyword+" by", next
+		case "union", "intersect", "except":
+			a.union = true
+			continue
+		case "distinct":
+			if s, ok := a.clauses[clauseSelect]; ok && a.isNextAfter(s.body, i) {
+				a.distinct = true
+			}
+			continue
+		case clauseSelect, clauseFrom, clauseWhere, clauseHaving, clauseWindow, clauseLimit, clauseOffset, clauseFetch, clauseFor:
+		default:
+			continue
+		}
+
+		if _, found := a.clauses[clauseSelect]; !found && keyword != clauseSelect {
+			continue
+		}
+		if _, found := a.clauses[keyword]; !found {
+			a.clauses[keyword] = sqlClause{start: t.start, body: a.tokens[bodyToken].end}
+		}
+	}
+	return a
+}
+
+// isNextAfter tells if the token i is the first significant one after the offset
+func (a queryAnalysis) isNextAfter(offset, i int) bool {
+	for j := i - 1; j >= 0 && a.tokens[j].end > offset; j-- {
+		if a.tokens[j].significant() {
+			return false
+		}
+	}
+	return true
+}
+
+func (a queryAnalysis) has(clause string) bool {
+	_, found := a.clauses[clause]
+	return found
+}
+
+// end returns the offset where the clause stops: the start of the next clause or the end of the query
+func (a queryAnalysis) end(clause string) int {
+	c := a.clauses[clause]
+	end := len(a.query)
+	for _, other := range a.clauses {
+		if other.start > c.start && other.start < end {
+			end = other.start
+		}
+	}
+	return end
+}
+
+// body returns the text of the clause without its keyword
+func (a queryAnalysis) body(clause string) string {
+	return strings.TrimSpace(a.query[a.clauses[clause].body:a.end(clause)])
+}
+
+// insertionPoint returns where a clause missing from the query must be written: before the first of the following clauses
+func (a queryAnalysis) insertionPoint(following ...string) int {
+	at := len(a.query)
+	for _, clause := range following {
+		if c, found := a.clauses[clause]; found && c.start < at {
+			at = c.start
+		}
+	}
+	return at
+}
+
+// hasTopLevel tells if the keyword is found between the offsets outside parentheses
+func (a queryAnalysis) hasTopLevel(keyword string, from, to int) bool {
+	for _, t := range a.tokens {
+		if t.start >= from && t.end <= to && t.depth == 0 && t.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastSignificant returns the index of the last token that is not a blank nor a comment, -1 for an empty query
+func (a queryAnalysis) lastSignificant() int {
+	for i := len(a.tokens) - 1; i >= 0; i-- {
+		if a.tokens[i].significant() {
+			return i
+		}
+	}
+	return -1
+}
+
+// splice replaces the text between the offsets, separating the parts with single blanks.
+// A part ending with a line comment is followed by a new line, so the next part is not commented out
+func splice(query string, from, to int, text string) string {
+	var b strings.Builder
+	for _, p := range []string{query[:from], text, query[to:]} {
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			b.WriteString(sqlSeparator(b.String()))
+			b.WriteString(p)
+		}
+	}
+	return b.String()
+}
+
+// sqlSeparator returns the blank to write after the text: none for an empty text, a new line after a line comment
+func sqlSeparator(text string) string {
+	if len(text) == 0 {
+		return ""
+	}
+
+	tokens := lexSQL(text)
+	last := tokens[len(tokens)-1]
+	if last.kind == tokenComment && !strings.HasPrefix(last.text, "/*") {
+		return "\n"
+	}
+	return " "
+}
+
+// addWhereConditions adds the conditions to the where clause of the main query, creating it when missing.
+// A where clause with a top level or is kept in parentheses so the conditions apply to all of it
+func addWhereConditions(query, conditions string) string {
+	return addConditions(query, clauseWhere, conditions, clausesAfterFrom[1:]...)
+}
+
+// addHavingConditions adds the conditions to the having clause of the main query, creating it after the group by when missing
+func addHavingConditions(query, conditions string) string {
+	return addConditions(query, clauseHaving, conditions, clausesAfterFrom[3:]...)
+}
+
+// addConditions adds the conditions to the clause, a missing clause is written before the first of the following ones
+func addConditions(query, clause, conditions string, following ...string) string {
+	a := analyzeQuery(query)
+
+	if !a.has(clause) {
+		at := a.insertionPoint(following...)
+		return splice(query, at, at, fmt.Sprintf("%s %s", clause, conditions))
+	}
+
+	body := a.body(clause)
+	if a.hasTopLevel("or", a.clauses[clause].body, a.end(clause)) {
+		body = fmt.Sprintf("(%s)", body)
+	}
+	return splice(query, a.clauses[clause].start, a.end(clause), fmt.Sprintf("%s %s and %s", clause, body, conditions))
+}
+
+// addOrderBy sorts the main query by the items, the sort criteria already in the query are kept after them
+func addOrderBy(query, items string) string {
+	a := analyzeQuery(query)
+
+	if !a.has(clauseOrderBy) {
+		at := a.insertionPoint(clauseLimit, clauseOffset, clauseFetch, clauseFor)
+		return splice(query, at, at, fmt.Sprintf("order by %s", items))
+	}
+
+	return splice(query, a.clauses[clauseOrderBy].start, a.end(clauseOrderBy), fmt.Sprintf("order by %s, %s", items, a.body(clauseOrderBy)))
+}
+
+// appendOrderBy sorts the main query by the items after the sort criteria already in the query
+func appendOrderBy(query, items string) string {
+	a := analyzeQuery(query)
+
+	if !a.has(clauseOrderBy) {
+		return addOrderBy(query, items)
+	}
+	return splice(query, a.clauses[clauseOrderBy].start, a.end(clauseOrderBy), fmt.Sprintf("order by %s, %s", a.body(clauseOrderBy), items))
+}
+
+// reverseOrderBy flips the direction and the nulls placement of every sort criterion of the main query
+func reverseOrderBy(query string) string {
+	a := analyzeQuery(query)
+	if !a.has(clauseOrderBy) {
+		return query
+	}
+
+	from, end := a.clauses[clauseOrderBy].body, a.end(clauseOrderBy)
+	var items []string
+	start := from
+	for _, t := range a.tokens {
+		if t.start >= from && t.end <= end && t.depth == 0 && t.text == "," {
+			items = append(items, reverseOrderItem(query[start:t.start]))
+			start = t.end
+		}
+	}
+	items = append(items, reverseOrderItem(query[start:end]))
+	return splice(query, a.clauses[clauseOrderBy].start, end, fmt.Sprintf("order by %s", strings.Join(items, ", ")))
+}
+
+// reverseOrderItem flips the direction and the nulls placement of a sort criterion. Ex: a desc nulls first is a nulls last
+func reverseOrderItem(item string) string {
+	tokens := lexSQL(item)
+	end := len(item)
+	desc := false
+	nulls := ""
+
+	last := previousSignificant(tokens, len(tokens))
+	if last >= 0 && (tokens[last].is(NullsFirst) || tokens[last].is(NullsLast)) {
+		if before := previousSignificant(tokens, last); before >= 0 && tokens[before].is("nulls") {
+			nulls = strings.ToLower(tokens[last].text)
+			end = tokens[before].start
+			last = previousSignificant(tokens, before)
+		}
+	}
+	if last >= 0 && (tokens[last].is("desc") || tokens[last].is("asc")) {
+		desc = tokens[last].is("desc")
+		end = tokens[last].start
+	}
+
+	reversed := strings.TrimSpace(item[:end])
+	if !desc {
+		reversed = fmt.Sprintf("%s desc", reversed)
+	}
+	switch nulls {
+	case NullsFirst:
+		reversed = fmt.Sprintf("%s nulls %s", reversed, NullsLast)
+	case NullsLast:
+		reversed = fmt.Sprintf("%s nulls %s", reversed, NullsFirst)
+	}
+	return reversed
+}
+
+// replaceSelectList replaces the columns of the main select
+func replaceSelectList(query, columns string) string {
+	a := analyzeQuery(query)
+	if !a.has(clauseSelect) || !a.has(clauseFrom) {
+		return query
+	}
+	return splice(query, a.clauses[clauseSelect].body, a.clauses[clauseFrom].start, columns)
+}
+
+// addSelectColumns adds the columns at the end of the select list of the main query
+func addSelectColumns(query, columns string) string {
+	a := analyzeQuery(query)
+	if !a.has(clauseFrom) {
+		return query
+	}
+
+	at := a.clauses[clauseFrom].start
+	selectList := strings.TrimRight(query[:at], " \t\r\n")
+	if sqlSeparator(selectList) == "\n" {
+		selectList += "\n"
+	}
+	return fmt.Sprintf("%s, %s %s", selectList, columns, query[at:])
+}
+
+// removeClause removes a top level clause of the main query
+func removeClause(query, clause string) string {
+	a := analyzeQuery(query)
+	if !a.has(clause) {
+		return query
+	}
+	return trimQuery(splice(query, a.clauses[clause].start, a.end(clause), ""))
+}
+
+// derivedTableAlias is the alias of the derived table wrapping the unions, the queries with common table expressions
+// and the ones already limited
+const derivedTableAlias = "q"
+
+// splitWith separates the common table expressions starting the query from its main statement
+func splitWith(query string) (with string, main string) {
+	a := analyzeQuery(query)
+	if !a.with || !a.has(clauseSelect) {
+		return "", query
+	}
+
+	at := a.clauses[clauseSelect].start
+	return strings.TrimSpace(query[:at]), strings.TrimSpace(query[at:])
+}
+
+// joinWith writes the common table expressions back before the main statement
+func joinWith(with, main string) string {
+	return splice(with, len(with), len(with), main)
+}
+
+// wrapDerivedTable reads a union, a query with common table expressions or a query with its own limit, offset or fetch
+// as a derived table, so the filters, sorts and limits apply to its lines.
+// The common table expressions stay before the select of the derived table
+func wrapDerivedTable(query string) string {
+	a := analyzeQuery(query)
+	if !a.with && !a.union && !a.has(clauseLimit) && !a.has(clauseOffset) && !a.has(clauseFetch) {
+		return query
+	}
+
+	with, main := splitWith(query)
+	return joinWith(with, fmt.Sprintf("select * from (%s) as %s", main, derivedTableAlias))
+}
+
+// trimQuery removes the blanks, comments and semicolons ending the query, so the clauses added later are not commented out
+func trimQuery(query string) string {
+	tokens := lexSQL(query)
+	last := previousSignificant(tokens, len(tokens))
+	for last >= 0 && tokens[last].text == ";" {
+		last = previousSignificant(tokens, last)
+	}
+	if last < 0 {
+		return ""
+	}
+	return strings.TrimSpace(query[:tokens[last].end])
+}
@@ -0,0 +1,365 @@
+package poctools
+
+import (
+	"testing"
+)
+
+func TestAnalyzeQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		clauses  []string
+		missing  []string
+		union    bool
+		distinct bool
+	}{
+		{
+			name:    "clauses of the main select",
+			query:   "select a from t where b = 1 group by a having count(1) > 1 order by a limit 10",
+			clauses: []string{clauseSelect, clauseFrom, clauseWhere, clauseGroupBy, clauseHaving, clauseOrderBy, clauseLimit},
+		},
+		{
+			name:    "sub query clauses are skipped",
+			query:   "select a from (select a from t where b = 1 order by a limit 1) x",
+			clauses: []string{clauseSelect, clauseFrom},
+			missing: []string{clauseWhere, clauseOrderBy, clauseLimit},
+		},
+		{
+			name:    "keywords in comments and literals are skipped",
+			query:   "select 'where' as a from t -- order by a\n/* limit 1 */",
+			clauses: []string{clauseSelect, clauseFrom},
+			missing: []string{clauseWhere, clauseOrderBy, clauseLimit},
+		},
+		{
+			name:    "union",
+			query:   "select a from t union select a from u",
+			clauses: []string{clauseSelect, clauseFrom},
+			union:   true,
+		},
+		{
+			name:     "distinct",
+			query:    "select distinct a from t",
+			clauses:  []string{clauseSelect, clauseFrom},
+			distinct: true,
+		},
+		{
+			name:    "offset fetch",
+			query:   "select a from t order by a offset 10 rows fetch next 5 rows only",
+			clauses: []string{clauseOrderBy, clauseOffset, clauseFetch},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := analyzeQuery(tt.query)
+			for _, clause := range tt.clauses {
+				if !a.has(clause) {
+					t.Errorf("clause %s not found", clause)
+				}
+			}
+			for _, clause := range tt.missing {
+				if a.has(clause) {
+					t.Errorf("clause %s found", clause)
+				}
+			}
+			if a.union != tt.union {
+				t.Errorf("union: got %v, want %v", a.union, tt.union)
+			}
+			if a.distinct != tt.distinct {
+				t.Errorf("distinct: got %v, want %v", a.distinct, tt.distinct)
+			}
+		})
+	}
+}
+
+func TestAddWhereConditions(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"no where", "select a from t", "select a from t where b = ?"},
+		{"before the sort", "select a from t order by a", "select a from t where b = ? order by a"},
+		{"existing where", "select a from t where c = 1 limit 5", "select a from t where c = 1 and b = ? limit 5"},
+		{"existing or", "select a from t where c = 1 or d = 2", "select a from t where (c = 1 or d = 2) and b = ?"},
+		{"before the group by", "select a from t group by a", "select a from t where b = ? group by a"},
+		{"sub query where is kept", "select a from (select a from t where c = 1) x", "select a from (select a from t where c = 1) x where b = ?"},
+		{"trailing line comment", "select a from t -- the lines", "select a from t -- the lines\nwhere b = ?"},
+		{"where in a literal", "select 'where' from t", "select 'where' from t where b = ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addWhereConditions(tt.query, "b = ?"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddHavingConditions(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"no having", "select a from t group by a order by a", "select a from t group by a having count(1) > ? order by a"},
+		{"existing having", "select a from t group by a having sum(b) > 1", "select a from t group by a having sum(b) > 1 and count(1) > ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addHavingConditions(tt.query, "count(1) > ?"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		add    string
+		append string
+	}{
+		{
+			name:   "no sort",
+			query:  "select a from t",
+			add:    "select a from t order by id",
+			append: "select a from t order by id",
+		},
+		{
+			name:   "existing sort",
+			query:  "select a from t order by a desc",
+			add:    "select a from t order by id, a desc",
+			append: "select a from t order by a desc, id",
+		},
+		{
+			name:   "before the limit",
+			query:  "select a from t limit 5",
+			add:    "select a from t order by id limit 5",
+			append: "select a from t order by id limit 5",
+		},
+		{
+			name:   "trailing line comment",
+			query:  "select a from t -- c",
+			add:    "select a from t -- c\norder by id",
+			append: "select a from t -- c\norder by id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addOrderBy(tt.query, "id"); got != tt.add {
+				t.Errorf("addOrderBy: got %q, want %q", got, tt.add)
+			}
+			if got := appendOrderBy(tt.query, "id"); got != tt.append {
+				t.Errorf("appendOrderBy: got %q, want %q", got, tt.append)
+			}
+		})
+	}
+}
+
+func TestReverseOrderBy(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"no sort", "select a from t", "select a from t"},
+		{"directions", "select a from t order by a, b desc, c asc", "select a from t order by a desc, b, c desc"},
+		{"nulls", "select a from t order by a nulls first, b desc nulls last", "select a from t order by a desc nulls last, b nulls first"},
+		{"expressions", "select a from t order by coalesce(a, b) desc, lower(c)", "select a from t order by coalesce(a, b), lower(c) desc"},
+		{"sub query sort is kept", "select a from (select a from t order by a) x order by a", "select a from (select a from t order by a) x order by a desc"},
+		{"before the limit", "select a from t order by a limit 5", "select a from t order by a desc limit 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reverseOrderBy(tt.query); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectList(t *testing.T) {
+	query := "select a, (select max(b) from u) as m from t"
+
+	if got, want := replaceSelectList(query, "count(1)"), "select count(1) from t"; got != want {
+		t.Errorf("replaceSelectList: got %q, want %q", got, want)
+	}
+	if got, want := addSelectColumns(query, "c"), "select a, (select max(b) from u) as m, c from t"; got != want {
+		t.Errorf("addSelectColumns: got %q, want %q", got, want)
+	}
+}
+
+func TestTrimQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"semicolon", "select a from t;", "select a from t"},
+		{"line comment", "select a from t -- the lines\n", "select a from t"},
+		{"comments and semicolons", "select a from t; /* end */ ; -- c", "select a from t"},
+		{"literal", "select ';' from t", "select ';' from t"},
+		{"empty", " -- c", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimQuery(tt.query); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapDerivedTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"plain query", "select a from t order by a", "select a from t order by a"},
+		{"limit", "select a from t order by a limit 5", "select * from (select a from t order by a limit 5) as q"},
+		{"offset fetch", "select a from t order by a offset 5 rows fetch next 5 rows only", "select * from (select a from t order by a offset 5 rows fetch next 5 rows only) as q"},
+		{"union", "select a from t union select a from u", "select * from (select a from t union select a from u) as q"},
+		{"common table expressions", "with x as (select a from t) select a from x", "with x as (select a from t) select * from (select a from x) as q"},
+		{"limit in a sub query", "select a from (select a from t limit 5) x", "select a from (select a from t limit 5) x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrapDerivedTable(tt.query); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCountQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		limit int64
+		want  string
+		pars  []interface{}
+	}{
+		{
+			name:  "select list replaced",
+			query: "select a, b from t where c = ? order by a",
+			want:  "select count(1) from t where c = ?",
+		},
+		{
+			name:  "grouped query",
+			query: "select a, count(1) from t group by a order by a",
+			want:  "select count(1) from (select a, count(1) from t group by a) as cnt",
+		},
+		{
+			name:  "distinct query",
+			query: "select distinct a from t",
+			want:  "select count(1) from (select distinct a from t) as cnt",
+		},
+		{
+			name:  "limited query keeps its sort",
+			query: "select a from t order by a limit 5",
+			want:  "select count(1) from (select a from t order by a limit 5) as cnt",
+		},
+		{
+			name:  "count limit",
+			query: "select a from t order by a",
+			limit: 100,
+			want:  "select count(1) from (select 1 from t limit ?) as cnt",
+			pars:  []interface{}{int64(101)},
+		},
+		{
+			name:  "count limit of a limited query",
+			query: "select a from t order by a limit 5",
+			limit: 100,
+			want:  "select count(1) from (select 1 from (select a from t order by a limit 5) as counted limit ?) as cnt",
+			pars:  []interface{}{int64(101)},
+		},
+		{
+			name:  "common table expressions",
+			query: "with x as (select a from t) select a from x",
+			want:  "with x as (select a from t) select count(1) from x",
+		},
+		{
+			name:  "trailing comment",
+			query: "select a from t -- the lines",
+			limit: 10,
+			want:  "select count(1) from (select 1 from t limit ?) as cnt",
+			pars:  []interface{}{int64(11)},
+		},
+		{
+			name:  "locking clause removed",
+			query: "select a from t where b = ? order by a for update",
+			want:  "select count(1) from t where b = ?",
+		},
+		{
+			name:  "locking clause of a grouped query removed",
+			query: "select a from t group by a for share",
+			limit: 10,
+			want:  "select count(1) from (select 1 from (select a from t group by a) as counted limit ?) as cnt",
+			pars:  []interface{}{int64(11)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, pars := getCountQuery(tt.query, tt.limit)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if len(pars) != len(tt.pars) {
+				t.Fatalf("got arguments %v, want %v", pars, tt.pars)
+			}
+			for i := range pars {
+				if pars[i] != tt.pars[i] {
+					t.Errorf("argument %d: got %v, want %v", i, pars[i], tt.pars[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetCountQuerySQLServer(t *testing.T) {
+	SetDialect(SQLServer)
+	defer SetDialect(MySQL)
+
+	got, _ := getCountQuery("select a from t order by a", 0)
+	if want := "select count(1) from t"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got, _ = getCountQuery("select a from t group by a order by a", 0)
+	if want := "select count(1) from (select a from t group by a) as cnt"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"end of the query", "select a from t order by a", "select a from t order by a limit ?"},
+		{"before the locking clause", "select a from t order by a for update", "select a from t order by a limit ? for update"},
+		{"locking clause with options", "select a from t for update of t skip locked", "select a from t limit ? for update of t skip locked"},
+		{"locking clause of a sub query", "select a from (select a from t for update) x", "select a from (select a from t for update) x limit ?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &sqlQuery{sql: tt.query}
+			q.setLimit("limit ?", []interface{}{int64(10)})
+			if q.sql != tt.want {
+				t.Errorf("got %q, want %q", q.sql, tt.want)
+			}
+		})
+	}
+}
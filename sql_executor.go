@@ -1,22 +1,31 @@
 package poctools
 
 import (
+	"context"
 	"fmt"
 )
 
 type SqlExecutor interface {
 	ReadMany(sql string, entity interface{}, pars ...interface{}) error
-	readManyPaginated(sql string, entity interface{}, p ApiParams, pars ...interface{}) (total int64, err error)
+	readManyPaginated(sql string, entity interface{}, p ApiParams, pars ...interface{}) (count PageCount, err error)
+	readManyPaginatedBuilder(b *QueryBuilder, entity interface{}, p ApiParams) (count PageCount, err error)
 	ReadOne(sqlStmt string, entity interface{}, pars ...interface{}) error
 	Write(sql string, entity interface{}) (uint64, error)
 }
 
 type sqlExecutor struct {
-	ds DbSession
+	ds    DbSession
+	cache CountCache
 }
 
+// CreateSqlExecutor creates an executor sharing the DefaultCountCache
 func CreateSqlExecutor(dbSession DbSession) SqlExecutor {
-	return &sqlExecutor{ds: dbSession}
+	return &sqlExecutor{ds: dbSession, cache: DefaultCountCache}
+}
+
+// CreateSqlExecutorWithCountCache creates an executor keeping its totals in the given cache, nil disables it
+func CreateSqlExecutorWithCountCache(dbSession DbSession, cache CountCache) SqlExecutor {
+	return &sqlExecutor{ds: dbSession, cache: cache}
 }
 
 func (S *sqlExecutor) ReadOne(query string, entity interface{}, pars ...interface{}) error {
@@ -34,48 +43,102 @@ func (S *sqlExecutor) ReadMany(query string, entity interface{}, pars ...interfa
 	return nil
 }
 
-func (S *sqlExecutor) readManyPaginated(sql string, entity interface{}, apiParam ApiParams, pars ...interface{}) (total int64, err error) {
+func (S *sqlExecutor) readManyPaginated(sql string, entity interface{}, apiParam ApiParams, pars ...interface{}) (count PageCount, err error) {
+	// the unions, the queries with common table expressions and the limited ones are filtered, sorted and counted as a derived table
+	return S.readPaged(&sqlQuery{sql: wrapDerivedTable(trimQuery(sql)), args: pars}, entity, apiParam)
+}
+
+// readManyPaginatedBuilder reads a page of the builder, the builder itself is unchanged
+func (S *sqlExecutor) readManyPaginatedBuilder(b *QueryBuilder, entity interface{}, apiParam ApiParams) (count PageCount, err error) {
+	return S.readPaged(b.clone(), entity, apiParam)
+}
 
-	queryToBeCounted, extraParsToBeCounted := getFilteredQuery(sql, apiParam.Filters)
-	extraParsToBeCounted = append(pars, extraParsToBeCounted...)
+// readPaged filters the query, reads its page and finds its total
+func (S *sqlExecutor) readPaged(toBeCounted pagedQuery, entity interface{}, apiParam ApiParams) (count PageCount, err error) {
 
-	var query string
-	query, paginationParams := getPaginatedQuery(queryToBeCounted, apiParam)
-	pars = append(extraParsToBeCounted, paginationParams...)
+	toBeCounted.filter(apiParam.Filters, apiParam.Conditions)
 
-	err = S.ds.ReadMany(query, entity, pars...)
+	page, err := paginateQuery(toBeCounted.copyQuery(), apiParam)
 	if err != nil {
-		message := "error in paginated query execution"
-		return 0, fmt.Errorf(message)
+		return count, fmt.Errorf("unable to paginate the query: %w", err)
 	}
 
-	if apiParam.Pagination.Marker == "last" {
-		S.reverseResult(entity)
+	// with the window count the total is read with the page, the count query only runs for an empty page
+	window := windowed(apiParam, entity, toBeCounted)
+	var windowTotal *int64
+	if window {
+		page.addColumns(windowCountColumn())
 	}
+	query, pars := page.Build()
 
-	if !apiParam.Options[Option.NoCount] {
-		var res []int64
-		_, hasGroupBy, _, _ := testClauses(query)
-		var countQuery string
-
-		if hasGroupBy {
-			countQuery = fmt.Sprintf("select count(1) from (%s) as cnt", queryToBeCounted)
-
+	readPage := func(exec *sqlExecutor) (err error) {
+		if window {
+			windowTotal, err = readWindowPage(exec.ds, query, entity, pars...)
 		} else {
-			countQuery = replaceInMainQuery(queryToBeCounted, "select.* from", "select count(1) from")
+			err = exec.ds.ReadMany(query, entity, pars...)
 		}
-		err = S.ds.ReadMany(countQuery, &res, extraParsToBeCounted...)
 		if err != nil {
-			message := "error reading total from paginated query execution"
-			return 0, fmt.Errorf(message)
+			message := "error in paginated query execution"
+			return fmt.Errorf(message)
+		}
+		return nil
+	}
+	readTotal := func(exec *sqlExecutor) (err error) {
+		if windowTotal != nil {
+			count = PageCount{Total: *windowTotal, Exact: true}
+			return nil
 		}
+		count, err = exec.readCount(toBeCounted, apiParam)
+		return err
+	}
 
-		total = res[0]
+	// the page and the total are read in parallel on the pool, in order within a transaction
+	if session, ok := S.parallelSession(apiParam); ok && !window {
+		ctx := apiParam.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		exec := &sqlExecutor{ds: contextSession{session, ctx}, cache: S.cache}
+		err = runParallel(ctx, func() error { return readPage(exec) }, func() error { return readTotal(exec) })
+	} else {
+		err = readPage(S)
+		if err == nil {
+			err = readTotal(S)
+		}
+	}
+	if err != nil {
+		return count, err
+	}
+
+	// without an exact count one more line was read to know if there are more lines
+	more := false
+	if lookahead(apiParam) > 0 {
+		more = S.trimResult(entity, pageSize(apiParam))
 	}
 
-	return total, err
+	if paginationStrategy(apiParam).Reversed(apiParam) {
+		S.reverseResult(entity)
+	}
+
+	count.More = more
+	return count, nil
 }
 
+// Write runs the statement, invalidating the cached totals of the changed table.
+// They are invalidated again when the transaction ends, a count run before the commit could have cached them
 func (S *sqlExecutor) Write(sql string, entity interface{}) (uint64, error) {
-	return S.ds.Write(sql, entity)
+	id, err := S.ds.Write(sql, entity)
+
+	if S.cache != nil {
+		if table := writtenTable(sql); len(table) > 0 {
+			cache := S.cache
+			invalidate := func() { cache.Invalidate(table) }
+			invalidate()
+			if listener, ok := S.ds.(transactionListener); ok {
+				listener.afterTransaction(invalidate)
+			}
+		}
+	}
+	return id, err
 }
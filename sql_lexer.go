@@ -0,0 +1,215 @@
+package poctools
+
+import (
+	"strings"
+)
+
+type sqlTokenKind int
+
+const (
+	tokenSpace sqlTokenKind = iota
+	tokenComment
+	// tokenWord is a keyword or a plain identifier
+	tokenWord
+	// tokenQuoted is a quoted identifier: `name`, "name" or [name]
+	tokenQuoted
+	tokenString
+	tokenNumber
+	tokenPlaceholder
+	tokenSymbol
+)
+
+// sqlToken is a piece of the query, start and end are its byte offsets.
+// depth is the number of parentheses around it, a parenthesis has the depth of its outside
+type sqlToken struct {
+	kind  sqlTokenKind
+	text  string
+	start int
+	end   int
+	depth int
+}
+
+// significant tells if the token is not a blank nor a comment
+func (t sqlToken) significant() bool {
+	return t.kind != tokenSpace && t.kind != tokenComment
+}
+
+// is tells if the token is the given keyword, whatever its case
+func (t sqlToken) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// lexSQL splits the query in tokens, the quotes and comments of the dialect are kept whole
+func lexSQL(query string) []sqlToken {
+	name := GetDialect().Name()
+	backslashEscapes := name == "mysql"
+	hashComments := name == "mysql"
+	brackets := name == "sqlserver"
+
+	var tokens []sqlToken
+	depth := 0
+	for i := 0; i < len(query); {
+		start := i
+		c := query[i]
+		kind := tokenSymbol
+		tokenDepth := depth
+
+		switch {
+		case isSQLSpace(c):
+			kind = tokenSpace
+			for i < len(query) && isSQLSpace(query[i]) {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "--") || (hashComments && c == '#'):
+			kind = tokenComment
+			i = indexFrom(query, i, "\n", len(query))
+		case strings.HasPrefix(query[i:], "/*"):
+			kind = tokenComment
+			i = indexFrom(query, i+2, "*/", len(query)-2) + 2
+		case c == '\'':
+			kind = tokenString
+			i = endOfQuoted(query, i, '\'', backslashEscapes)
+		case c == '"' || c == '`':
+			kind = tokenQuoted
+			i = endOfQuoted(query, i, c, false)
+		case c == '[' && brackets:
+			kind = tokenQuoted
+			i = endOfQuoted(query, i, ']', false)
+		case c == '$' && dollarTag(query[i:]) != "":
+			kind = tokenString
+			tag := dollarTag(query[i:])
+			i = indexFrom(query, i+len(tag), tag, len(query)-len(tag)) + len(tag)
+		case c == '?' || (c == '$' && i+1 < len(query) && isSQLDigit(query[i+1])):
+			kind = tokenPlaceholder
+			i++
+			for i < len(query) && isSQLDigit(query[i]) {
+				i++
+			}
+		case isSQLWordStart(c):
+			kind = tokenWord
+			for i < len(query) && (isSQLWordStart(query[i]) || isSQLDigit(query[i]) || query[i] == '$') {
+				i++
+			}
+		case isSQLDigit(c):
+			kind = tokenNumber
+			for i < len(query) && (isSQLDigit(query[i]) || query[i] == '.') {
+				i++
+			}
+		default:
+			i++
+			if c == '(' {
+				depth++
+			} else if c == ')' && depth > 0 {
+				depth--
+				tokenDepth = depth
+			}
+		}
+
+		tokens = append(tokens, sqlToken{kind: kind, text: query[start:i], start: start, end: i, depth: tokenDepth})
+	}
+	return tokens
+}
+
+// endOfQuoted returns the offset after the closing quote, a doubled quote or an escaped one does not close it
+func endOfQuoted(query string, i int, closing byte, backslashEscapes bool) int {
+	for i++; i < len(query); i++ {
+		switch {
+		case backslashEscapes && query[i] == '\\':
+			i++
+		case query[i] == closing:
+			if i+1 < len(query) && query[i+1] == closing {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+// dollarTag returns the opening $tag$ of a PostgreSQL dollar quoted string, empty when there is none
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '$' {
+			return s[:i+1]
+		}
+		if !isSQLWordStart(s[i]) && !(i > 1 && isSQLDigit(s[i])) {
+			return ""
+		}
+	}
+	return ""
+}
+
+func indexFrom(s string, from int, sub string, notFound int) int {
+	if from > len(s) {
+		return notFound
+	}
+	if idx := strings.Index(s[from:], sub); idx >= 0 {
+		return from + idx
+	}
+	return notFound
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isSQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSQLWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// nextSignificant returns the index of the first token after i that is not a blank nor a comment, -1 when there is none
+func nextSignificant(tokens []sqlToken, i int) int {
+	for i++; i < len(tokens); i++ {
+		if tokens[i].significant() {
+			return i
+		}
+	}
+	return -1
+}
+
+// previousSignificant returns the index of the last token before i that is not a blank nor a comment, -1 when there is none
+func previousSignificant(tokens []sqlToken, i int) int {
+	for i--; i >= 0; i-- {
+		if tokens[i].significant() {
+			return i
+		}
+	}
+	return -1
+}
+
+// identifierAt reads the possibly dotted name starting at the token i, returning it with the index of its last token
+func identifierAt(tokens []sqlToken, i int) (string, int) {
+	if i < 0 || i >= len(tokens) || (tokens[i].kind != tokenWord && tokens[i].kind != tokenQuoted) {
+		return "", i
+	}
+
+	name := tokens[i].text
+	for i+2 < len(tokens) && tokens[i+1].text == "." && (tokens[i+2].kind == tokenWord || tokens[i+2].kind == tokenQuoted) {
+		name += "." + tokens[i+2].text
+		i += 2
+	}
+	return name, i
+}
+
+// normalizeSQL joins the tokens with a single blank where there were blanks or comments
+func normalizeSQL(query string) string {
+	var b strings.Builder
+	blank := false
+	for _, t := range lexSQL(query) {
+		if !t.significant() {
+			blank = true
+			continue
+		}
+		if blank && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		blank = false
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
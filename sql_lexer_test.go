@@ -0,0 +1,126 @@
+package poctools
+
+import (
+	"testing"
+)
+
+func TestLexSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		kinds   []sqlTokenKind
+		texts   []string
+	}{
+		{
+			name:    "line comment runs to the end of the line",
+			dialect: MySQL,
+			query:   "a -- b where\nc",
+			kinds:   []sqlTokenKind{tokenWord, tokenSpace, tokenComment, tokenSpace, tokenWord},
+			texts:   []string{"a", " ", "-- b where", "\n", "c"},
+		},
+		{
+			name:    "block comment",
+			dialect: PostgreSQL,
+			query:   "a/* where ? */b",
+			kinds:   []sqlTokenKind{tokenWord, tokenComment, tokenWord},
+			texts:   []string{"a", "/* where ? */", "b"},
+		},
+		{
+			name:    "hash comment of MySQL",
+			dialect: MySQL,
+			query:   "a # b",
+			kinds:   []sqlTokenKind{tokenWord, tokenSpace, tokenComment},
+			texts:   []string{"a", " ", "# b"},
+		},
+		{
+			name:    "doubled quote in a string",
+			dialect: PostgreSQL,
+			query:   "'it''s ?'",
+			kinds:   []sqlTokenKind{tokenString},
+			texts:   []string{"'it''s ?'"},
+		},
+		{
+			name:    "backslash escape of MySQL",
+			dialect: MySQL,
+			query:   `'a\'?' ?`,
+			kinds:   []sqlTokenKind{tokenString, tokenSpace, tokenPlaceholder},
+			texts:   []string{`'a\'?'`, " ", "?"},
+		},
+		{
+			name:    "dollar quoted string of PostgreSQL",
+			dialect: PostgreSQL,
+			query:   "$tag$ where ? $tag$",
+			kinds:   []sqlTokenKind{tokenString},
+			texts:   []string{"$tag$ where ? $tag$"},
+		},
+		{
+			name:    "quoted identifiers",
+			dialect: SQLServer,
+			query:   `[order] "group"`,
+			kinds:   []sqlTokenKind{tokenQuoted, tokenSpace, tokenQuoted},
+			texts:   []string{"[order]", " ", `"group"`},
+		},
+	}
+
+	defer SetDialect(MySQL)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDialect(tt.dialect)
+			tokens := lexSQL(tt.query)
+			if len(tokens) != len(tt.kinds) {
+				t.Fatalf("got %d tokens %v, want %d", len(tokens), tokens, len(tt.kinds))
+			}
+			for i, token := range tokens {
+				if token.kind != tt.kinds[i] || token.text != tt.texts[i] {
+					t.Errorf("token %d: got %d %q, want %d %q", i, token.kind, token.text, tt.kinds[i], tt.texts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLexSQLDepth(t *testing.T) {
+	tokens := lexSQL("a (b (c)) d")
+
+	depths := map[string]int{"a": 0, "b": 1, "c": 2, "d": 0}
+	for _, token := range tokens {
+		if want, ok := depths[token.text]; ok && token.depth != want {
+			t.Errorf("%s: got depth %d, want %d", token.text, token.depth, want)
+		}
+	}
+}
+
+func TestRebindPlaceholders(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		query  string
+		want   string
+	}{
+		{"placeholders", "$%d", "a = ? and b = ?", "a = $1 and b = $2"},
+		{"string", "$%d", "a = '?' and b = ?", "a = '?' and b = $1"},
+		{"comment", "$%d", "a = ? -- b = ?\nand c = ?", "a = $1 -- b = ?\nand c = $2"},
+		{"quoted identifier", "$%d", `"a?" = ?`, `"a?" = $1`},
+		{"after the native placeholders", "$%d", "a = $2 and b = $1 and c = ? limit ?", "a = $2 and b = $1 and c = $3 limit $4"},
+		{"native placeholder in a string", "$%d", "a = '$5' and b = ?", "a = '$5' and b = $1"},
+		{"named placeholders", "@p%d", "a = ? and b = ?", "a = @p1 and b = @p2"},
+		{"after the native named placeholders", "@p%d", "a = @p1 and b = ?", "a = @p1 and b = @p2"},
+		{"other variables", "@p%d", "a = @pages and b = ?", "a = @pages and b = @p1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rebindPlaceholders(tt.query, tt.format); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeSQL(t *testing.T) {
+	got := normalizeSQL("select  a /* b */\n from t -- c")
+	if want := "select a from t"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+package poctools
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterType defines how the values of a filter are parsed before reaching the database
+type FilterType string
+
+const (
+	FilterTypeString    FilterType = "string"
+	FilterTypeInt       FilterType = "int"
+	FilterTypeFloat     FilterType = "float"
+	FilterTypeBool      FilterType = "bool"
+	FilterTypeDate      FilterType = "date"
+	FilterTypeTimestamp FilterType = "timestamp"
+	FilterTypeUUID      FilterType = "uuid"
+	FilterTypeEnum      FilterType = "enum"
+)
+
+// ParamError describes one invalid query parameter
+type ParamError struct {
+	Param  string `json:"param"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError lists every invalid query parameter of a request, handlers should answer it with a 400
+type ValidationError struct {
+	Errors []ParamError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Errors))
+	for i, pe := range e.Errors {
+		reasons[i] = fmt.Sprintf("%s: %s", pe.Param, pe.Reason)
+	}
+	return fmt.Sprintf("invalid query parameters: %s", strings.Join(reasons, "; "))
+}
+
+func (e *ValidationError) add(param, value, reason string) {
+	e.Errors = append(e.Errors, ParamError{Param: param, Value: value, Reason: reason})
+}
+
+// merge adds the invalid parameters of another *ValidationError, any other error is returned as it is
+func (e *ValidationError) merge(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var other *ValidationError
+	if !errors.As(err, &other) {
+		return err
+	}
+	e.Errors = append(e.Errors, other.Errors...)
+	return nil
+}
+
+// orNil returns nil when no invalid parameter was found, so it can be returned as an error
+func (e *ValidationError) orNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// rawValues returns the values of the filter as they came in the query parameters
+func (f Filter) rawValues() []string {
+	switch f.Operator {
+	case OperatorBetween:
+		return strings.SplitN(f.Value, ",", 2)
+	case OperatorIn:
+		return f.Values
+	}
+	return []string{f.Value}
+}
+
+// boundValues returns the values bound to the filter condition, the parsed ones when the filter was validated
+func (f Filter) boundValues() []interface{} {
+	if f.args != nil {
+		return f.args
+	}
+
+	raws := f.rawValues()
+	values := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		values[i] = raw
+	}
+	return values
+}
+
+// coerce parses the raw values of the filter according to its type, reporting the invalid ones in verr
+func (f *Filter) coerce(param string, verr *ValidationError) {
+	if f.Operator == OperatorLike {
+		return
+	}
+
+	raws := f.rawValues()
+	args := make([]interface{}, 0, len(raws))
+	for _, raw := range raws {
+		value, err := coerceFilterValue(f.Type, f.AllowedValues, raw)
+		if err != nil {
+			verr.add(param, raw, err.Error())
+			continue
+		}
+		args = append(args, value)
+	}
+	f.args = args
+}
+
+func coerceFilterValue(t FilterType, allowed []string, raw string) (interface{}, error) {
+	switch t {
+	case FilterTypeInt:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return v, nil
+	case FilterTypeFloat:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return v, nil
+	case FilterTypeBool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return v, nil
+	case FilterTypeDate:
+		v, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a date formatted as YYYY-MM-DD")
+		}
+		return v, nil
+	case FilterTypeTimestamp:
+		v, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a RFC 3339 timestamp")
+		}
+		return v, nil
+	case FilterTypeUUID:
+		if !isUUID(raw) {
+			return nil, fmt.Errorf("must be an uuid")
+		}
+		return strings.ToLower(raw), nil
+	case FilterTypeEnum:
+		for _, a := range allowed {
+			if a == raw {
+				return raw, nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+	return raw, nil
+}
+
+// isUUID checks the canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}